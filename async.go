@@ -0,0 +1,110 @@
+package zlogsentry
+
+import (
+	"sync"
+	"time"
+
+	"github.com/getsentry/sentry-go"
+)
+
+type asyncEvent struct {
+	hub   *sentry.Hub
+	event *sentry.Event
+	raw   []byte
+	// closed by the worker instead of capturing, see drain
+	drained chan struct{}
+}
+
+// asyncQueue captures events in a background goroutine.
+type asyncQueue struct {
+	mu      sync.RWMutex
+	closed  bool
+	events  chan asyncEvent
+	done    chan struct{}
+	capture func(asyncEvent)
+}
+
+func newAsyncQueue(size int, capture func(asyncEvent)) *asyncQueue {
+	q := &asyncQueue{
+		events:  make(chan asyncEvent, size),
+		done:    make(chan struct{}),
+		capture: capture,
+	}
+
+	go q.run()
+
+	return q
+}
+
+func (q *asyncQueue) run() {
+	defer close(q.done)
+
+	for e := range q.events {
+		if e.drained != nil {
+			close(e.drained)
+			continue
+		}
+		q.capture(e)
+	}
+}
+
+// push enqueues the event and reports false if the queue is full.
+// Events pushed after close are captured synchronously.
+func (q *asyncQueue) push(e asyncEvent) bool {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+
+	if q.closed {
+		q.capture(e)
+		return true
+	}
+
+	select {
+	case q.events <- e:
+		return true
+	default:
+		return false
+	}
+}
+
+// drain waits until the events queued so far are captured or the timeout is reached.
+func (q *asyncQueue) drain(timeout time.Duration) bool {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	drained := make(chan struct{})
+
+	q.mu.RLock()
+	if q.closed {
+		q.mu.RUnlock()
+		// close waits for the queued events
+		<-q.done
+		return true
+	}
+	select {
+	case q.events <- asyncEvent{drained: drained}:
+	case <-timer.C:
+		q.mu.RUnlock()
+		return false
+	}
+	q.mu.RUnlock()
+
+	select {
+	case <-drained:
+		return true
+	case <-timer.C:
+		return false
+	}
+}
+
+// close stops accepting events and waits until queued ones are captured.
+func (q *asyncQueue) close() {
+	q.mu.Lock()
+	if !q.closed {
+		q.closed = true
+		close(q.events)
+	}
+	q.mu.Unlock()
+
+	<-q.done
+}
@@ -0,0 +1,99 @@
+package zlogsentry
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/getsentry/sentry-go"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWrite_Async(t *testing.T) {
+	var (
+		captured atomic.Int32
+		started  = make(chan struct{}, 3)
+		release  = make(chan struct{})
+	)
+
+	writer, err := New("",
+		WithAsync(1),
+		WithBeforeSend(func(event *sentry.Event, hint *sentry.EventHint) *sentry.Event {
+			started <- struct{}{}
+			<-release
+			captured.Add(1)
+			return event
+		}))
+	require.Nil(t, err)
+
+	_, err = writer.WriteLevel(zerolog.ErrorLevel, logEventJSON)
+	require.Nil(t, err)
+	<-started
+
+	// first event blocks the worker, second fills the queue and third is dropped
+	_, _ = writer.WriteLevel(zerolog.ErrorLevel, logEventJSON)
+	_, _ = writer.WriteLevel(zerolog.ErrorLevel, logEventJSON)
+	assert.Equal(t, uint64(1), writer.DroppedEvents())
+	assert.Equal(t, int32(0), captured.Load())
+
+	close(release)
+	require.Nil(t, writer.Close())
+	assert.Equal(t, int32(2), captured.Load())
+}
+
+func TestWrite_AsyncCopiesData(t *testing.T) {
+	var message atomic.Value
+	release := make(chan struct{})
+
+	writer, err := New("",
+		WithAsync(1),
+		WithBeforeSend(func(event *sentry.Event, hint *sentry.EventHint) *sentry.Event {
+			<-release
+			message.Store(event.Message)
+			return event
+		}))
+	require.Nil(t, err)
+
+	data := append([]byte(nil), logEventJSON...)
+	_, err = writer.WriteLevel(zerolog.ErrorLevel, data)
+	require.Nil(t, err)
+
+	// zerolog reuses its buffers once Write returns
+	for i := range data {
+		data[i] = 'x'
+	}
+
+	close(release)
+	require.Nil(t, writer.Close())
+	assert.Equal(t, "test message", message.Load())
+}
+
+func TestWrite_AsyncFatalDrainsQueue(t *testing.T) {
+	transport := &testTransport{}
+	writer, err := New("",
+		WithTransport(transport),
+		WithAsync(10),
+		WithLevels(zerolog.ErrorLevel, zerolog.FatalLevel),
+		WithBeforeSend(func(event *sentry.Event, hint *sentry.EventHint) *sentry.Event {
+			// keep events queued until the fatal one
+			time.Sleep(5 * time.Millisecond)
+			return event
+		}))
+	require.Nil(t, err)
+
+	const queued = 5
+	for i := 0; i < queued; i++ {
+		_, err = writer.WriteLevel(zerolog.ErrorLevel, logEventJSON)
+		require.Nil(t, err)
+	}
+	// zerolog exits once the fatal line is written
+	_, err = writer.WriteLevel(zerolog.FatalLevel, []byte(`{"level":"fatal","message":"exiting"}`))
+	require.Nil(t, err)
+
+	transport.mu.Lock()
+	defer transport.mu.Unlock()
+	require.Len(t, transport.events, queued+1)
+	assert.Equal(t, "exiting", transport.events[queued].Message)
+}
@@ -0,0 +1,79 @@
+package zlogsentry
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/tls"
+	"io"
+	"net/http"
+	"net/url"
+
+	"github.com/getsentry/sentry-go"
+)
+
+// gzipTransport compresses request bodies sent by the base round tripper.
+type gzipTransport struct {
+	base http.RoundTripper
+}
+
+func (t gzipTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Body == nil || req.Header.Get("Content-Encoding") != "" {
+		return t.base.RoundTrip(req)
+	}
+
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	_, err := io.Copy(zw, req.Body)
+	_ = req.Body.Close()
+	if err == nil {
+		err = zw.Close()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	compressed := req.Clone(req.Context())
+	body := buf.Bytes()
+	compressed.Body = io.NopCloser(bytes.NewReader(body))
+	compressed.GetBody = func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(body)), nil
+	}
+	compressed.ContentLength = int64(len(body))
+	compressed.Header.Set("Content-Encoding", "gzip")
+
+	return t.base.RoundTrip(compressed)
+}
+
+// wraps the round tripper of the default transport, as configured by the options, into gzipTransport
+func compressTransport(options *sentry.ClientOptions) {
+	if options.HTTPClient != nil {
+		client := *options.HTTPClient
+		base := client.Transport
+		if base == nil {
+			base = http.DefaultTransport
+		}
+		client.Transport = gzipTransport{base: base}
+		options.HTTPClient = &client
+		return
+	}
+
+	base := options.HTTPTransport
+	if base == nil {
+		// same as the one created by the default transport
+		transport := &http.Transport{Proxy: http.ProxyFromEnvironment}
+		if proxy := options.HTTPSProxy; proxy != "" || options.HTTPProxy != "" {
+			if proxy == "" {
+				proxy = options.HTTPProxy
+			}
+			transport.Proxy = func(*http.Request) (*url.URL, error) {
+				return url.Parse(proxy)
+			}
+		}
+		if options.CaCerts != nil {
+			// #nosec G402 -- matches the default transport
+			transport.TLSClientConfig = &tls.Config{RootCAs: options.CaCerts}
+		}
+		base = transport
+	}
+	options.HTTPTransport = gzipTransport{base: base}
+}
@@ -0,0 +1,49 @@
+package zlogsentry
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWithCompression(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		encoding string
+		body     string
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		zr, err := gzip.NewReader(r.Body)
+		if err == nil {
+			var data []byte
+			data, err = io.ReadAll(zr)
+			mu.Lock()
+			encoding, body = r.Header.Get("Content-Encoding"), string(data)
+			mu.Unlock()
+		}
+		assert.Nil(t, err)
+	}))
+	defer server.Close()
+
+	dsn := strings.Replace(server.URL, "http://", "http://public@", 1) + "/1"
+	writer, err := New(dsn, WithCompression(true), WithFlushTimeout(5*time.Second))
+	require.Nil(t, err)
+
+	_, err = writer.WriteLevel(zerolog.ErrorLevel, logEventJSON)
+	require.Nil(t, err)
+	require.Nil(t, writer.Close())
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, "gzip", encoding)
+	assert.Contains(t, body, "test message")
+}
@@ -0,0 +1,89 @@
+package zlogsentry
+
+import (
+	"hash/fnv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/getsentry/sentry-go"
+)
+
+// dedupMaxKeys bounds the number of remembered events.
+const dedupMaxKeys = 1024
+
+// dedupCache remembers recently captured events to suppress identical ones within a window.
+type dedupCache struct {
+	mu     sync.Mutex
+	window time.Duration
+	seen   map[uint64]time.Time
+}
+
+func newDedupCache(window time.Duration) *dedupCache {
+	return &dedupCache{
+		window: window,
+		seen:   make(map[uint64]time.Time),
+	}
+}
+
+// duplicate reports whether an identical event was seen within the window
+// and remembers the event otherwise.
+func (c *dedupCache) duplicate(event *sentry.Event) bool {
+	key := dedupKey(event)
+	ts := now()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if seenAt, ok := c.seen[key]; ok && ts.Sub(seenAt) < c.window {
+		return true
+	}
+
+	if len(c.seen) >= dedupMaxKeys {
+		c.evict(ts)
+	}
+	c.seen[key] = ts
+
+	return false
+}
+
+// removes expired keys, or the oldest one if none has expired
+func (c *dedupCache) evict(ts time.Time) {
+	var (
+		oldestKey uint64
+		oldestAt  time.Time
+	)
+	for key, seenAt := range c.seen {
+		if ts.Sub(seenAt) >= c.window {
+			delete(c.seen, key)
+			continue
+		}
+		if oldestAt.IsZero() || seenAt.Before(oldestAt) {
+			oldestKey, oldestAt = key, seenAt
+		}
+	}
+
+	if len(c.seen) >= dedupMaxKeys {
+		delete(c.seen, oldestKey)
+	}
+}
+
+// hashes the fingerprint of the event, or its message and exceptions
+func dedupKey(event *sentry.Event) uint64 {
+	h := fnv.New64a()
+
+	if len(event.Fingerprint) > 0 {
+		_, _ = h.Write([]byte(strings.Join(event.Fingerprint, "\x00")))
+		return h.Sum64()
+	}
+
+	_, _ = h.Write([]byte(event.Message))
+	for _, exc := range event.Exception {
+		_, _ = h.Write([]byte{0})
+		_, _ = h.Write([]byte(exc.Type))
+		_, _ = h.Write([]byte{0})
+		_, _ = h.Write([]byte(exc.Value))
+	}
+
+	return h.Sum64()
+}
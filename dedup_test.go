@@ -0,0 +1,50 @@
+package zlogsentry
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/getsentry/sentry-go"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWrite_Deduplication(t *testing.T) {
+	ts := time.Now()
+	now = func() time.Time { return ts }
+	defer func() { now = time.Now }()
+
+	var drops []DropReason
+	transport := &testTransport{}
+	writer, err := New("",
+		WithTransport(transport),
+		WithDeduplication(time.Minute),
+		WithOnDrop(func(reason DropReason) {
+			drops = append(drops, reason)
+		}))
+	require.Nil(t, err)
+
+	log := zerolog.New(writer)
+	log.Error().Msg("first")
+	log.Error().Msg("first")
+	log.Error().Msg("second")
+	assert.Len(t, transport.events, 2)
+	assert.Equal(t, []DropReason{DropReasonDuplicate}, drops)
+
+	ts = ts.Add(time.Minute)
+	log.Error().Msg("first")
+	assert.Len(t, transport.events, 3)
+	assert.Equal(t, uint64(1), writer.DroppedEvents())
+}
+
+func TestDedupCache_Bounded(t *testing.T) {
+	cache := newDedupCache(time.Minute)
+
+	for i := 0; i < dedupMaxKeys*2; i++ {
+		assert.False(t, cache.duplicate(&sentry.Event{Message: fmt.Sprint(i)}))
+	}
+	assert.Len(t, cache.seen, dedupMaxKeys)
+	assert.True(t, cache.duplicate(&sentry.Event{Message: fmt.Sprint(dedupMaxKeys*2 - 1)}))
+}
@@ -0,0 +1,88 @@
+package zlogsentry
+
+import (
+	"github.com/getsentry/sentry-go"
+	"github.com/rs/zerolog"
+)
+
+// writerHook sends zerolog events through the writer without parsing json.
+type writerHook struct {
+	w *Writer
+}
+
+// Hook returns a zerolog hook sending events through the writer, e.g. instead of adding
+// the writer as a second output of zerolog.MultiLevelWriter, so log lines are not parsed back.
+// Levels, sampling, breadcrumbs and the other writer options are honored, but zerolog does not
+// expose event fields to hooks, so events carry the level and the message only.
+func (w *Writer) Hook() zerolog.Hook {
+	return writerHook{w: w}
+}
+
+func (h writerHook) Run(_ *zerolog.Event, level zerolog.Level, message string) {
+	h.w.writeMessage(level, message)
+}
+
+func (w *Writer) writeMessage(level zerolog.Level, message string) {
+	settings := w.settings.Load()
+
+	if _, enabled := settings.levels[level]; enabled {
+		if !settings.sample(level) {
+			w.drop(DropReasonSampled)
+			return
+		}
+
+		if !w.allow(level) {
+			w.drop(DropReasonRateLimited)
+			return
+		}
+
+		event := w.newMessageEvent(message)
+		event.Level = w.levelsMapping[level]
+		w.setLevelTag(event, level)
+		if _, messageOnly := w.messageOnlyLevels[level]; !messageOnly {
+			w.addSyntheticException(event, level)
+		}
+		w.capture(w.levelHub(level, w.hub), event, nil, isExiting(level))
+		return
+	}
+
+	if _, enabled := settings.breadcrumbLevels[level]; enabled {
+		w.hub.AddBreadcrumb(w.newBreadcrumb(message, level), nil)
+		return
+	}
+
+	w.drop(DropReasonLevelDisabled)
+}
+
+// builds an event out of the message like parseLogEvent does for a log line without fields
+func (w *Writer) newMessageEvent(message string) *sentry.Event {
+	event := &sentry.Event{
+		Timestamp: now(),
+		Logger:    w.loggerName,
+		Platform:  w.platform,
+		Message:   w.truncateMessage(message),
+		Extra:     make(map[string]interface{}),
+	}
+
+	if len(w.defaultTags) > 0 {
+		event.Tags = make(map[string]string, len(w.defaultTags))
+		for k, v := range w.defaultTags {
+			event.Tags[k] = v
+		}
+	}
+	event.Contexts = w.newDefaultContexts()
+
+	if message != "" && w.fingerprintStrategy == FingerprintFromMessage {
+		event.Fingerprint = []string{event.Message}
+	}
+
+	if w.fingerprintFunc != nil {
+		event.Fingerprint = w.fingerprintFunc(event)
+	}
+
+	if w.eventMutator != nil {
+		w.eventMutator(event, nil)
+	}
+
+	return event
+}
@@ -0,0 +1,53 @@
+package zlogsentry
+
+import (
+	"io"
+	"testing"
+
+	"github.com/getsentry/sentry-go"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHook(t *testing.T) {
+	transport := &testTransport{}
+	writer, err := New("",
+		WithTransport(transport),
+		WithBreadcrumbLevels(zerolog.InfoLevel),
+		WithDefaultTags(map[string]string{"service": "api"}))
+	require.Nil(t, err)
+
+	log := zerolog.New(io.Discard).Hook(writer.Hook())
+	log.Debug().Msg("skipped")
+	log.Info().Msg("cache miss")
+	log.Error().Str("key", "user:1").Msg("test message")
+
+	require.Len(t, transport.events, 1)
+	event := transport.events[0]
+	assert.Equal(t, "test message", event.Message)
+	assert.Equal(t, sentry.LevelError, event.Level)
+	assert.Equal(t, "api", event.Tags["service"])
+	require.Len(t, event.Breadcrumbs, 1)
+	assert.Equal(t, "cache miss", event.Breadcrumbs[0].Message)
+	assert.Equal(t, uint64(1), writer.DroppedEvents())
+}
+
+func TestHook_SyntheticException(t *testing.T) {
+	transport := &testTransport{}
+	writer, err := New("", WithTransport(transport), WithSyntheticException(), WithLevels(zerolog.WarnLevel, zerolog.ErrorLevel))
+	require.Nil(t, err)
+
+	log := zerolog.New(io.Discard).Hook(writer.Hook())
+	log.Warn().Msg("slow response")
+	log.Error().Msg("test message")
+
+	require.Len(t, transport.events, 2)
+	assert.Empty(t, transport.events[0].Exception)
+	require.Len(t, transport.events[1].Exception, 1)
+	exc := transport.events[1].Exception[0]
+	assert.Equal(t, "error", exc.Type)
+	assert.Equal(t, "test message", exc.Value)
+	require.NotNil(t, exc.Stacktrace)
+	assert.NotEmpty(t, exc.Stacktrace.Frames)
+}
@@ -0,0 +1,45 @@
+package zlogsentry
+
+import (
+	"sync"
+	"time"
+)
+
+// tokenBucket allows up to rate events per second with bursts of the same size.
+type tokenBucket struct {
+	mu     sync.Mutex
+	rate   float64
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(perSecond int) *tokenBucket {
+	return &tokenBucket{
+		rate:   float64(perSecond),
+		tokens: float64(perSecond),
+		last:   now(),
+	}
+}
+
+// allow takes a token and reports false if the bucket is empty.
+func (b *tokenBucket) allow() bool {
+	ts := now()
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if elapsed := ts.Sub(b.last); elapsed > 0 {
+		b.tokens += elapsed.Seconds() * b.rate
+		if b.tokens > b.rate {
+			b.tokens = b.rate
+		}
+		b.last = ts
+	}
+
+	if b.tokens < 1 {
+		return false
+	}
+
+	b.tokens--
+	return true
+}
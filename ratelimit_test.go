@@ -0,0 +1,46 @@
+package zlogsentry
+
+import (
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWrite_RateLimit(t *testing.T) {
+	ts := time.Now()
+	now = func() time.Time { return ts }
+	defer func() { now = time.Now }()
+
+	var drops []DropReason
+	transport := &testTransport{}
+	writer, err := New("",
+		WithTransport(transport),
+		WithLevels(zerolog.ErrorLevel, zerolog.FatalLevel),
+		WithRateLimit(zerolog.ErrorLevel, 50),
+		WithRateLimit(zerolog.FatalLevel, 1),
+		WithOnDrop(func(reason DropReason) {
+			drops = append(drops, reason)
+		}))
+	require.Nil(t, err)
+
+	// 1000 events spread over 2 seconds
+	for i := 0; i < 1000; i++ {
+		_, err = writer.WriteLevel(zerolog.ErrorLevel, logEventJSON)
+		require.Nil(t, err)
+		ts = ts.Add(2 * time.Millisecond)
+	}
+	// initial burst plus 50 events per second
+	assert.InDelta(t, 150, len(transport.events), 1)
+	assert.Equal(t, uint64(1000-len(transport.events)), writer.DroppedEvents())
+	assert.Equal(t, DropReasonRateLimited, drops[0])
+
+	sent := len(transport.events)
+	for i := 0; i < 10; i++ {
+		_, err = writer.WriteLevel(zerolog.FatalLevel, logEventJSON)
+		require.Nil(t, err)
+	}
+	assert.Len(t, transport.events, sent+10)
+}
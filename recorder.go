@@ -0,0 +1,86 @@
+package zlogsentry
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/getsentry/sentry-go"
+)
+
+// RecordedEvents holds events captured by a writer created with NewTestWriter.
+// It is safe for concurrent use.
+type RecordedEvents struct {
+	mu     sync.Mutex
+	events []*sentry.Event
+}
+
+// Events returns a copy of the recorded events in the order they were captured.
+func (r *RecordedEvents) Events() []*sentry.Event {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return append([]*sentry.Event(nil), r.events...)
+}
+
+// Len returns the number of recorded events.
+func (r *RecordedEvents) Len() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return len(r.events)
+}
+
+// Reset drops the recorded events.
+func (r *RecordedEvents) Reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.events = nil
+}
+
+// recordingTransport records events instead of sending them.
+type recordingTransport struct {
+	recorded *RecordedEvents
+}
+
+func (t recordingTransport) Configure(sentry.ClientOptions) {}
+
+func (t recordingTransport) SendEvent(event *sentry.Event) {
+	t.recorded.mu.Lock()
+	defer t.recorded.mu.Unlock()
+
+	t.recorded.events = append(t.recorded.events, event)
+}
+
+func (t recordingTransport) Flush(time.Duration) bool { return true }
+
+// NewTestWriter creates writer recording events in memory instead of sending them, so tests can assert
+// the events produced by logging. Events go through the same parsing and client processing as with New,
+// but the global hub is left untouched and WithTransport is ignored. WithProjectForLevels is rejected,
+// as events routed to other projects would not be recorded.
+// Recorded events do not reference buffers passed to Write.
+func NewTestWriter(opts ...WriterOption) (*Writer, *RecordedEvents, error) {
+	cfg := newDefaultConfig()
+	for _, opt := range opts {
+		opt.apply(&cfg)
+	}
+	if len(cfg.projects) > 0 {
+		return nil, nil, errors.New("zlogsentry: WithProjectForLevels is not supported by NewTestWriter")
+	}
+	cfg.resolve()
+
+	// recorded events outlive Write calls
+	cfg.safeCopy = true
+
+	recorded := &RecordedEvents{}
+	clientOptions := cfg.clientOptions("")
+	clientOptions.Transport = recordingTransport{recorded: recorded}
+
+	client, err := sentry.NewClient(clientOptions)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return newWriter(sentry.NewHub(client, sentry.NewScope()), cfg), recorded, nil
+}
@@ -0,0 +1,43 @@
+package zlogsentry
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/getsentry/sentry-go"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewTestWriter(t *testing.T) {
+	globalClient := sentry.CurrentHub().Client()
+
+	writer, recorded, err := NewTestWriter(WithTags("component"), WithLevels(zerolog.ErrorLevel, zerolog.FatalLevel))
+	require.Nil(t, err)
+	assert.Same(t, globalClient, sentry.CurrentHub().Client())
+
+	log := zerolog.New(writer)
+	log.Info().Msg("skipped")
+	log.Error().Str("component", "billing").Err(errors.New("dial timeout")).Msg("charge failed")
+	log.Error().Msg("second")
+
+	events := recorded.Events()
+	require.Len(t, events, 2)
+	assert.Equal(t, sentry.LevelError, events[0].Level)
+	assert.Equal(t, "charge failed", events[0].Message)
+	assert.Equal(t, "billing", events[0].Tags["component"])
+	assert.Equal(t, "dial timeout", events[0].Exception[0].Value)
+	assert.Equal(t, "second", events[1].Message)
+
+	recorded.Reset()
+	assert.Equal(t, 0, recorded.Len())
+
+	_, _, err = NewTestWriter(WithClientOptions(func(options *sentry.ClientOptions) {
+		options.Dsn = "invalid"
+	}))
+	assert.NotNil(t, err)
+
+	_, _, err = NewTestWriter(WithProjectForLevels("https://key@o0.ingest.sentry.io/1", zerolog.FatalLevel))
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,42 @@
+package zlogsentry
+
+import (
+	"io"
+
+	"github.com/rs/zerolog"
+)
+
+// teeWriter writes to the primary writer and then to the Sentry writer.
+type teeWriter struct {
+	primary io.Writer
+	w       *Writer
+}
+
+// Tee returns a writer sending log lines to primary, e.g. os.Stdout, and then to the writer,
+// like zerolog.MultiLevelWriter(primary, w) does, except that the primary write always happens
+// and only its byte count and error are returned, so local logs are not lost to Sentry errors,
+// e.g. ErrMalformedLogEvent in strict mode.
+// The returned writer also implements io.Closer, Close closes the writer but not primary.
+func (w *Writer) Tee(primary io.Writer) zerolog.LevelWriter {
+	return teeWriter{primary: primary, w: w}
+}
+
+func (t teeWriter) Write(p []byte) (n int, err error) {
+	n, err = t.primary.Write(p)
+	_, _ = t.w.Write(p)
+	return n, err
+}
+
+func (t teeWriter) WriteLevel(level zerolog.Level, p []byte) (n int, err error) {
+	if lw, ok := t.primary.(zerolog.LevelWriter); ok {
+		n, err = lw.WriteLevel(level, p)
+	} else {
+		n, err = t.primary.Write(p)
+	}
+	_, _ = t.w.WriteLevel(level, p)
+	return n, err
+}
+
+func (t teeWriter) Close() error {
+	return t.w.Close()
+}
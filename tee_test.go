@@ -0,0 +1,33 @@
+package zlogsentry
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTee(t *testing.T) {
+	transport := &testTransport{}
+	writer, err := New("", WithTransport(transport), WithStrictParsing(), WithSafeCopy())
+	require.Nil(t, err)
+
+	var out bytes.Buffer
+	tee := writer.Tee(&out)
+
+	log := zerolog.New(tee)
+	log.Error().Msg("test message")
+
+	require.Len(t, transport.events, 1)
+	assert.Equal(t, "test message", transport.events[0].Message)
+
+	// the primary write result is returned even though the writer rejects the line
+	out.Reset()
+	n, err := tee.WriteLevel(zerolog.ErrorLevel, []byte("not json\n"))
+	assert.Nil(t, err)
+	assert.Equal(t, 9, n)
+	assert.Equal(t, "not json\n", out.String())
+	assert.Len(t, transport.events, 1)
+}
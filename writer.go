@@ -1,137 +1,361 @@
 package zlogsentry
 
 import (
+	"bytes"
+	"context"
+	cryptorand "crypto/rand"
 	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
+	"math/rand"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"runtime"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
+	"unicode/utf8"
 	"unsafe"
 
 	"github.com/buger/jsonparser"
 	"github.com/getsentry/sentry-go"
 	"github.com/rs/zerolog"
+	"go.opentelemetry.io/otel/trace"
 )
 
 var levelsMapping = map[zerolog.Level]sentry.Level{
+	zerolog.TraceLevel: sentry.LevelDebug,
 	zerolog.DebugLevel: sentry.LevelDebug,
 	zerolog.InfoLevel:  sentry.LevelInfo,
 	zerolog.WarnLevel:  sentry.LevelWarning,
 	zerolog.ErrorLevel: sentry.LevelError,
 	zerolog.FatalLevel: sentry.LevelFatal,
 	zerolog.PanicLevel: sentry.LevelFatal,
+	// written by zerolog.Logger.Log
+	zerolog.NoLevel: sentry.LevelInfo,
 }
 
 var _ = io.WriteCloser(new(Writer))
 
 var now = time.Now
 
+var random = rand.Float64
+
+var readBuildInfo = debug.ReadBuildInfo
+
+var hostname = os.Hostname
+
 // Writer is a sentry events writer with std io.Writer iface.
 type Writer struct {
 	hub *sentry.Hub
 
-	levels       map[zerolog.Level]struct{}
-	flushTimeout time.Duration
+	// shared with the writers created by WithScope
+	*writerState
+
+	levelsMapping map[zerolog.Level]sentry.Level
+	tagFields     map[string]struct{}
+	tagPrefix     string
+	errorFields   map[string]int
+	defaultTags   map[string]string
+	levelTag      string
+	flushTimeout  time.Duration
+	// used for fatal and panic events instead of flushTimeout
+	fatalFlushTimeout time.Duration
+
+	userFields       UserFieldNames
+	withoutUserExtra bool
+
+	httpRequestFields *HTTPRequestFields
+	contextFields     map[string]string
+	defaultContexts   map[string]sentry.Context
+	breadcrumbsField  string
+	errorTypeField    string
+	transactionField  string
+	serverNameField   string
+	environmentField  string
+
+	stacktraceSkipModules []string
+	withoutStacktrace     bool
+	inAppModules          []string
+	maxStacktraceDepth    int
+	maxErrorDepth         int
+
+	maxExtraBytes   int
+	maxExtraFields  int
+	maxMessageBytes int
+
+	syntheticException bool
+	messageOnlyLevels  map[zerolog.Level]struct{}
+
+	traceIDField      string
+	spanIDField       string
+	parentSpanIDField string
+
+	loggerName   string
+	platform     string
+	logTimestamp bool
+	callerFrame  bool
+
+	// set by NewWithHub, the client options hold them otherwise
+	environment string
+	release     string
+
+	unixTimestampPrecision time.Duration
+	fingerprintFields      map[string]int
+	fingerprintStrategy    FingerprintStrategy
+	fingerprintFunc        func(event *sentry.Event) []string
+	eventMutator           EventMutator
+	redactFields           []string
+	redactPatterns         []*regexp.Regexp
+	rateLimits             map[zerolog.Level]*tokenBucket
+
+	ignoreMessages []string
+	dropFunc       DropFunc
+
+	runtimeContext     bool
+	memStatsSampleRate float64
+	rawLogLineHint     bool
+
+	// hubs of WithProjectForLevels, shared with the writers created by WithScope
+	levelHubs   map[zerolog.Level]*sentry.Hub
+	projectHubs []*sentry.Hub
+
+	async    *asyncQueue
+	dedup    *dedupCache
+	safeCopy bool
+	onDrop   func(reason DropReason)
+
+	strictParsing bool
+	defaultLevel  *zerolog.Level
+	debugWriter   io.Writer
 }
 
 // Write handles zerolog's json and sends events to sentry.
+// Newline delimited log lines, e.g. flushed at once by a buffered writer, are sent as separate events,
+// errors of the lines in strict parsing mode are joined.
 func (w *Writer) Write(data []byte) (n int, err error) {
 	n = len(data)
 
-	lvl, err := w.parseLogLevel(data)
-	if err != nil {
-		return n, nil
+	if bytes.IndexByte(bytes.TrimRight(data, "\r\n"), '\n') < 0 {
+		return n, w.writeLine(data)
 	}
 
-	if _, enabled := w.levels[lvl]; !enabled {
-		return
+	var errs []error
+	for rest := data; len(rest) > 0; {
+		line := rest
+		if idx := bytes.IndexByte(rest, '\n'); idx >= 0 {
+			line, rest = rest[:idx], rest[idx+1:]
+		} else {
+			rest = nil
+		}
+
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+		if lineErr := w.writeLine(line); lineErr != nil {
+			errs = append(errs, lineErr)
+		}
 	}
 
-	event, ok := w.parseLogEvent(data)
-	event.Level = levelsMapping[lvl]
+	return n, errors.Join(errs...)
+}
 
-	if ok {
-		w.hub.CaptureEvent(event)
-		// should flush before os.Exit
-		if event.Level == sentry.LevelFatal {
-			w.hub.Flush(w.flushTimeout)
+func (w *Writer) writeLine(data []byte) error {
+	lvl, err := w.parseLogLevel(data)
+	if errors.Is(err, ErrMalformedLogEvent) {
+		return w.malformed(data)
+	}
+	if err != nil {
+		if w.strictParsing {
+			return err
 		}
+		return nil
 	}
 
-	return
+	return w.write(context.Background(), w.hub, lvl, data)
 }
 
 // implements zerolog.LevelWriter
 func (w *Writer) WriteLevel(level zerolog.Level, p []byte) (n int, err error) {
 	n = len(p)
-	if _, enabled := w.levels[level]; !enabled {
-		return
-	}
+	err = w.write(context.Background(), w.hub, level, p)
+	return
+}
 
-	event, ok := w.parseLogEvent(p)
-	event.Level = levelsMapping[level]
+// WriteLevelContext is like WriteLevel, but sends the event through the hub bound to ctx
+// by sentry.SetHubOnContext (e.g. by sentry HTTP middlewares), so that request scoped data
+// like tags and user gets merged into the event. Falls back to the writer hub otherwise.
+// The OpenTelemetry span of ctx, if any, is set as the event trace context
+// unless the log line carries one, see WithTraceContextFields.
+func (w *Writer) WriteLevelContext(ctx context.Context, level zerolog.Level, p []byte) (n int, err error) {
+	n = len(p)
 
-	if ok {
-		w.hub.CaptureEvent(event)
-		// should flush before os.Exit
-		if event.Level == sentry.LevelFatal {
-			w.hub.Flush(w.flushTimeout)
-		}
+	hub := w.hub
+	if ctxHub := sentry.GetHubFromContext(ctx); ctxHub != nil {
+		hub = ctxHub
 	}
+	err = w.write(ctx, hub, level, p)
+
 	return
 }
 
-// Close forces client to flush all pending events.
-// Can be useful before application exits.
-func (w *Writer) Close() error {
-	w.hub.Flush(w.flushTimeout)
+// ErrMalformedLogEvent is returned by writes in strict parsing mode when the log line is not a valid json object.
+var ErrMalformedLogEvent = errors.New("zlogsentry: malformed log event")
+
+func (w *Writer) write(ctx context.Context, hub *sentry.Hub, level zerolog.Level, data []byte) error {
+	settings := w.settings.Load()
+
+	if _, enabled := settings.levels[level]; enabled {
+		if !settings.sample(level) {
+			w.drop(DropReasonSampled)
+			return nil
+		}
+
+		if !w.allow(level) {
+			w.drop(DropReasonRateLimited)
+			return nil
+		}
+
+		if w.async != nil || w.safeCopy {
+			// queued or retained events outlive the call while zerolog reuses its buffer
+			data = append([]byte(nil), data...)
+		}
+
+		_, messageOnly := w.messageOnlyLevels[level]
+		event, ok := w.parseEvent(data, messageOnly)
+		if !ok {
+			return w.malformed(data)
+		}
+
+		if w.dropFunc != nil {
+			if fields, isObject := w.parseObject(data); isObject && w.dropFunc(level, fields) {
+				w.drop(DropReasonFiltered)
+				return nil
+			}
+		}
+
+		event.Level = w.levelsMapping[level]
+		setSpanContext(ctx, event)
+		w.setLevelTag(event, level)
+		if !messageOnly {
+			w.addSyntheticException(event, level)
+		}
+
+		var raw []byte
+		if w.rawLogLineHint {
+			raw = data
+		}
+		w.capture(w.levelHub(level, hub), event, raw, isExiting(level))
+		return nil
+	}
+
+	if _, enabled := settings.breadcrumbLevels[level]; enabled {
+		// breadcrumbs are retained by the scope while zerolog reuses its buffer,
+		// so strings must not point into data
+		breadcrumb, ok := w.parseBreadcrumb(append([]byte(nil), data...), level)
+		if !ok {
+			return w.malformed(data)
+		}
+
+		hub.AddBreadcrumb(breadcrumb, nil)
+		return nil
+	}
+
+	if w.debugWriter != nil {
+		// lines of disabled levels are not parsed otherwise
+		if err := objectError(data); err != nil {
+			w.reportMalformed(data, err)
+		}
+	}
+
+	w.drop(DropReasonLevelDisabled)
 	return nil
 }
 
-// parses the log level from the encoded log
-func (w *Writer) parseLogLevel(data []byte) (zerolog.Level, error) {
-	lvlStr, err := jsonparser.GetUnsafeString(data, zerolog.LevelFieldName)
-	if err != nil {
-		return zerolog.Disabled, nil
+func (w *Writer) malformed(data []byte) error {
+	if w.debugWriter != nil {
+		// parsing fails only on invalid json, the error is not kept by parseEvent
+		w.reportMalformed(data, objectError(data))
 	}
 
-	return zerolog.ParseLevel(lvlStr)
+	if w.strictParsing {
+		return ErrMalformedLogEvent
+	}
+	return nil
 }
 
-// parses the event except the log level
-func (w *Writer) parseLogEvent(data []byte) (*sentry.Event, bool) {
-	const logger = "zerolog"
+// returns the error of parsing the line as a json object, if any
+func objectError(data []byte) error {
+	return jsonparser.ObjectEach(data, func(_, _ []byte, _ jsonparser.ValueType, _ int) error {
+		return nil
+	})
+}
 
-	event := sentry.Event{
+// maxReportedLineBytes limits the log line written to the debug writer.
+const maxReportedLineBytes = 256
+
+// writes the dropped log line and the parse error to the debug writer, if any
+func (w *Writer) reportMalformed(data []byte, err error) {
+	if w.debugWriter == nil {
+		return
+	}
+
+	line := strings.TrimRight(bytesToStrUnsafe(data), "\r\n")
+	if len(line) > maxReportedLineBytes {
+		line = truncateString(line, maxReportedLineBytes) + truncatedMarker
+	}
+	_, _ = fmt.Fprintf(w.debugWriter, "zlogsentry: dropped malformed log line: %v: %s\n", err, line)
+}
+
+// builds a breadcrumb out of the parsed event, dropping its exceptions into data
+func (w *Writer) newBreadcrumb(message string, level zerolog.Level) *sentry.Breadcrumb {
+	return &sentry.Breadcrumb{
+		Category:  w.loggerName,
+		Message:   w.truncateMessage(message),
+		Level:     w.levelsMapping[level],
 		Timestamp: now(),
-		Logger:    logger,
-		Extra:     make(map[string]interface{}),
 	}
+}
 
-	var (
-		message    string
-		exceptions []sentry.Exception
-	)
+// parses the log line into a breadcrumb keeping fields other than the message and the level as data,
+// unlike parseEvent no stacktrace or fingerprint is built and the event mutator is not called
+func (w *Writer) parseBreadcrumb(data []byte, level zerolog.Level) (*sentry.Breadcrumb, bool) {
+	names := w.fieldNames.Load()
+	breadcrumb := w.newBreadcrumb("", level)
+
+	// the event only holds the data within the extra limits
+	event := sentry.Event{Extra: make(map[string]interface{})}
+	var extra extraBudget
 
 	err := jsonparser.ObjectEach(data, func(key, value []byte, vt jsonparser.ValueType, offset int) error {
-		val := bytesToStrUnsafe(value)
+		redacted := w.redacted(key)
+		value, vt = w.redactField(key, value, vt)
+		if !redacted && len(w.redactPatterns) > 0 {
+			value = w.mask(value, vt)
+		}
+
 		switch string(key) {
-		case zerolog.MessageFieldName:
-			message = val
-			event.Fingerprint = append(event.Fingerprint, val)
-		case zerolog.ErrorFieldName:
-			exceptions = append(exceptions, sentry.Exception{
-				Value:      val,
-				Stacktrace: newStacktrace(),
-			})
-			event.Fingerprint = append(event.Fingerprint, val)
-		case zerolog.LevelFieldName, zerolog.TimestampFieldName:
+		case names.message:
+			breadcrumb.Message = w.truncateMessage(bytesToStrUnsafe(value))
+		case names.level:
 			// skip
-		case "user_id":
-			if event.User.ID == "" {
-				event.User.ID = val
+		case names.timestamp:
+			if w.logTimestamp {
+				if ts, ok := parseTimestamp(value, vt, w.unixTimestampPrecision); ok {
+					breadcrumb.Timestamp = ts
+				}
 			}
-			event.Extra["user_id"] = val
 		default:
-			event.Extra[string(key)] = val
+			w.addExtra(&event, &extra, string(key), w.parseValue(value, vt), len(value))
 		}
 		return nil
 	})
@@ -139,182 +363,2351 @@ func (w *Writer) parseLogEvent(data []byte) (*sentry.Event, bool) {
 		return nil, false
 	}
 
-	if fingerprint, err := jsonparser.GetString(data, "fingerprint"); err == nil && fingerprint != "" {
-		event.Fingerprint = []string{fingerprint}
+	if extra.truncated {
+		event.Extra["_truncated"] = true
 	}
+	breadcrumb.Data = event.Extra
 
-	event.Message = message
-	for _, exc := range exceptions {
-		exc.Type = message
-		event.Exception = append(event.Exception, exc)
+	return breadcrumb, true
+}
+
+// WriteError sends the error to sentry bypassing json parsing.
+// Unlike Write, the stacktrace is extracted from the error itself when it carries one
+// (e.g. errors created by github.com/pkg/errors), so it points to the error origin.
+// Wrapped and joined errors are searched for a stacktrace too, up to WithMaxErrorDepth.
+func (w *Writer) WriteError(err error, level zerolog.Level) {
+	if err == nil {
+		return
+	}
+
+	w.writeError(err, reflect.TypeOf(err).String(), level, isExiting(level), false)
+}
+
+// CaptureError is like WriteError, but walks the errors.Unwrap chain and sends each layer
+// as a separate exception typed after it, so sentry renders the chain as "caused by" exceptions.
+// The outermost error is the last exception. The chain is limited by WithMaxErrorDepth.
+func (w *Writer) CaptureError(err error, level zerolog.Level) {
+	if err == nil {
+		return
+	}
+
+	w.writeError(err, reflect.TypeOf(err).String(), level, isExiting(level), true)
+}
+
+// CapturePanic sends the value recovered from a panic as the event exception and flushes,
+// so it is reported even though the panic value is not in the log line written by zerolog.
+// Usable from a deferred recover, the level is used like in WriteError.
+func (w *Writer) CapturePanic(recovered interface{}, level zerolog.Level) {
+	if recovered == nil {
+		return
+	}
+
+	err, ok := recovered.(error)
+	if !ok {
+		err = fmt.Errorf("%v", recovered)
+	}
+
+	w.writeError(err, reflect.TypeOf(recovered).String(), level, true, false)
+}
+
+func (w *Writer) writeError(err error, errType string, level zerolog.Level, exiting, unwrap bool) {
+	settings := w.settings.Load()
+
+	if _, enabled := settings.levels[level]; !enabled {
+		w.drop(DropReasonLevelDisabled)
+		return
+	}
+
+	if !settings.sample(level) {
+		w.drop(DropReasonSampled)
+		return
+	}
+
+	if !w.allow(level) {
+		w.drop(DropReasonRateLimited)
+		return
+	}
+
+	var stacktrace *sentry.Stacktrace
+	if !w.withoutStacktrace {
+		if unwrap {
+			// wrapped layers carry their own stacktraces
+			stacktrace = sentry.ExtractStacktrace(err)
+		} else {
+			stacktrace = w.extractStacktrace(err)
+		}
+		if stacktrace == nil {
+			stacktrace = w.newStacktrace()
+		}
+		w.markInApp(stacktrace)
+	}
+
+	msg := err.Error()
+	event := &sentry.Event{
+		Timestamp: now(),
+		Logger:    w.loggerName,
+		Platform:  w.platform,
+		Level:     w.levelsMapping[level],
+		Message:   w.truncateMessage(msg),
+		Exception: []sentry.Exception{{
+			Type:       errType,
+			Value:      msg,
+			Stacktrace: stacktrace,
+		}},
+	}
+
+	if unwrap {
+		event.Exception = w.unwrapExceptions(err, event.Exception)
+	}
+
+	if w.fingerprintStrategy != FingerprintFromStacktrace {
+		event.Fingerprint = []string{event.Message}
+	}
+	if w.fingerprintFunc != nil {
+		event.Fingerprint = w.fingerprintFunc(event)
+	}
+
+	if len(w.defaultTags) > 0 {
+		event.Tags = make(map[string]string, len(w.defaultTags))
+		for k, v := range w.defaultTags {
+			event.Tags[k] = v
+		}
+	}
+	event.Contexts = w.newDefaultContexts()
+	w.setLevelTag(event, level)
+
+	w.capture(w.levelHub(level, w.hub), event, nil, exiting)
+}
+
+// same as the client default
+const defaultMaxErrorDepth = 10
+
+// extracts the stacktrace of the outermost error carrying one, e.g. a pkg/errors error wrapped by fmt.Errorf
+func (w *Writer) extractStacktrace(err error) *sentry.Stacktrace {
+	depth := w.maxErrorDepth
+	if depth <= 0 {
+		depth = defaultMaxErrorDepth
+	}
+
+	return findStacktrace(err, depth)
+}
+
+// searches the error tree depth-first, errors joined by errors.Join or fmt.Errorf in order
+func findStacktrace(err error, depth int) *sentry.Stacktrace {
+	if err == nil || depth <= 0 {
+		return nil
+	}
+	if stacktrace := sentry.ExtractStacktrace(err); stacktrace != nil {
+		return stacktrace
+	}
+
+	switch wrapper := err.(type) {
+	case interface{ Unwrap() []error }:
+		for _, wrapped := range wrapper.Unwrap() {
+			if stacktrace := findStacktrace(wrapped, depth-1); stacktrace != nil {
+				return stacktrace
+			}
+		}
+	case interface{ Unwrap() error }:
+		return findStacktrace(wrapper.Unwrap(), depth-1)
+	}
+	return nil
+}
+
+// prepends the exceptions of the errors wrapped by err to the exceptions of err, innermost first.
+// Wrapped errors only get a stacktrace when they carry one.
+func (w *Writer) unwrapExceptions(err error, exceptions []sentry.Exception) []sentry.Exception {
+	depth := w.maxErrorDepth
+	if depth <= 0 {
+		depth = defaultMaxErrorDepth
+	}
+
+	for cause := errors.Unwrap(err); cause != nil && len(exceptions) < depth; cause = errors.Unwrap(cause) {
+		exc := sentry.Exception{
+			Type:  reflect.TypeOf(cause).String(),
+			Value: cause.Error(),
+		}
+		if !w.withoutStacktrace {
+			exc.Stacktrace = sentry.ExtractStacktrace(cause)
+			w.markInApp(exc.Stacktrace)
+		}
+		exceptions = append(exceptions, exc)
+	}
+
+	for i, j := 0, len(exceptions)-1; i < j; i, j = i+1, j-1 {
+		exceptions[i], exceptions[j] = exceptions[j], exceptions[i]
+	}
+
+	return exceptions
+}
+
+// promotes the message of error level events without an error to an exception,
+// so they get a stacktrace and are grouped like errors
+func (w *Writer) addSyntheticException(event *sentry.Event, level zerolog.Level) {
+	if !w.syntheticException || len(event.Exception) > 0 {
+		return
+	}
+
+	switch level {
+	case zerolog.ErrorLevel, zerolog.FatalLevel, zerolog.PanicLevel:
+	default:
+		return
+	}
+
+	stacktrace := w.newStacktrace()
+	w.markInApp(stacktrace)
+	event.Exception = []sentry.Exception{{
+		Type:       level.String(),
+		Value:      event.Message,
+		Stacktrace: stacktrace,
+	}}
+}
+
+// sets the OpenTelemetry span of ctx as the trace context, unless the event has one
+func setSpanContext(ctx context.Context, event *sentry.Event) {
+	if _, traced := event.Contexts["trace"]; traced {
+		return
+	}
+
+	if sc := trace.SpanContextFromContext(ctx); sc.IsValid() {
+		setContext(event, "trace", sentry.TraceContext{
+			TraceID: sentry.TraceID(sc.TraceID()),
+			SpanID:  sentry.SpanID(sc.SpanID()),
+		}.Map())
+	}
+}
+
+// mirrors the zerolog level as a tag, as the sentry level is coarser
+func (w *Writer) setLevelTag(event *sentry.Event, level zerolog.Level) {
+	if w.levelTag == "" {
+		return
+	}
+
+	if event.Tags == nil {
+		event.Tags = make(map[string]string)
+	}
+	event.Tags[w.levelTag] = level.String()
+}
+
+// reports whether the process is about to exit or panic after logging at the level,
+// regardless of the mapped sentry level
+func isExiting(level zerolog.Level) bool {
+	return level == zerolog.FatalLevel || level == zerolog.PanicLevel
+}
+
+func (w *Writer) capture(hub *sentry.Hub, event *sentry.Event, raw []byte, exiting bool) {
+	if w.ignored(event.Message) {
+		w.drop(DropReasonIgnored)
+		return
+	}
+
+	if w.dedup != nil && w.dedup.duplicate(event) {
+		w.drop(DropReasonDuplicate)
+		return
+	}
+
+	if w.runtimeContext {
+		setContext(event, "go_runtime", w.newRuntimeContext())
+	}
+
+	if event.Environment == "" {
+		event.Environment = w.environment
+	}
+	if event.Release == "" {
+		event.Release = w.release
+	}
+
+	// exiting events are captured inline
+	if w.async != nil && !exiting {
+		if !w.async.push(asyncEvent{hub: hub, event: event, raw: raw}) {
+			w.drop(DropReasonQueueFull)
+		}
+		return
+	}
+
+	if !exiting {
+		w.captureSync(hub, event, raw)
+		return
+	}
+
+	// should flush before os.Exit or panic
+	if w.async == nil {
+		w.captureSync(hub, event, raw)
+		hub.Flush(w.fatalFlushTimeout)
+		return
+	}
+
+	// including the events queued before, which may have been captured by other hubs
+	deadline := time.Now().Add(w.fatalFlushTimeout)
+	w.async.drain(w.fatalFlushTimeout)
+	w.captureSync(hub, event, raw)
+	hub.Flush(time.Until(deadline))
+	w.flush(time.Until(deadline))
+}
+
+// reports whether the event of the level passes the per level sample rate
+func (s *levelSettings) sample(level zerolog.Level) bool {
+	rate, ok := s.sampleRates[level]
+	if !ok {
+		return true
+	}
+
+	return random() < rate
+}
+
+func (w *Writer) newRuntimeContext() sentry.Context {
+	ctx := sentry.Context{
+		"num_goroutine": runtime.NumGoroutine(),
+		"num_cpu":       runtime.NumCPU(),
+	}
+
+	if w.memStatsSampleRate > 0 && random() < w.memStatsSampleRate {
+		var stats runtime.MemStats
+		runtime.ReadMemStats(&stats)
+		ctx["mem_alloc"] = stats.Alloc
+		ctx["mem_sys"] = stats.Sys
 	}
 
-	return &event, true
+	return ctx
+}
+
+// reports whether the message contains any of the ignored substrings
+func (w *Writer) ignored(message string) bool {
+	for _, substr := range w.ignoreMessages {
+		if strings.Contains(message, substr) {
+			return true
+		}
+	}
+	return false
+}
+
+// reports whether the event of the level fits into the per level rate limit
+func (w *Writer) allow(level zerolog.Level) bool {
+	bucket, ok := w.rateLimits[level]
+	if !ok {
+		return true
+	}
+
+	return bucket.allow()
+}
+
+func (w *Writer) captureSync(hub *sentry.Hub, event *sentry.Event, raw []byte) {
+	var id *sentry.EventID
+	if raw == nil && (event.Platform == defaultPlatform || event.Platform == "") {
+		id = hub.CaptureEvent(event)
+	} else if client := hub.Client(); client != nil {
+		// the hub passes no hint and the client overwrites the platform before applying the scope
+		var hint *sentry.EventHint
+		if raw != nil {
+			hint = &sentry.EventHint{Data: RawLogLine(raw)}
+		}
+
+		var scope sentry.EventModifier = hub.Scope()
+		if event.Platform != defaultPlatform && event.Platform != "" {
+			scope = platformScope{scope: hub.Scope(), platform: event.Platform}
+		}
+		id = client.CaptureEvent(event, hint, scope)
+	}
+
+	failed := id == nil
+	w.captureFailed.Store(failed)
+	if failed {
+		w.drop(DropReasonClient)
+	}
+}
+
+// platformScope applies the scope and then restores the event platform.
+type platformScope struct {
+	scope    *sentry.Scope
+	platform string
+}
+
+func (s platformScope) ApplyToEvent(event *sentry.Event, hint *sentry.EventHint) *sentry.Event {
+	if event = s.scope.ApplyToEvent(event, hint); event != nil {
+		event.Platform = s.platform
+	}
+	return event
+}
+
+// LastCaptureFailed reports whether the client discarded the last captured event,
+// e.g. the hub has no client or the event was dropped by WithBeforeSend.
+// Such events are also counted by DroppedEvents with DropReasonClient. Events are delivered
+// by the transport in background, so network and authentication failures are not observed.
+func (w *Writer) LastCaptureFailed() bool {
+	return w.captureFailed.Load()
+}
+
+// DropReason describes why an event was not sent.
+type DropReason string
+
+const (
+	// DropReasonLevelDisabled is used for log lines of levels that are not sent to Sentry.
+	DropReasonLevelDisabled DropReason = "level_disabled"
+	// DropReasonSampled is used for events sampled out by WithLevelSampleRates.
+	DropReasonSampled DropReason = "sampled"
+	// DropReasonRateLimited is used for events over the limit set by WithRateLimit.
+	DropReasonRateLimited DropReason = "rate_limited"
+	// DropReasonQueueFull is used when the async queue is full, see WithAsync.
+	DropReasonQueueFull DropReason = "queue_full"
+	// DropReasonFiltered is used for events dropped by the WithDropFunc predicate.
+	DropReasonFiltered DropReason = "filtered"
+	// DropReasonIgnored is used for events whose message matches WithIgnoreMessages.
+	DropReasonIgnored DropReason = "ignored"
+	// DropReasonDuplicate is used for events suppressed by WithDeduplication.
+	DropReasonDuplicate DropReason = "duplicate"
+	// DropReasonClient is used when the client discards the event:
+	// it is sampled out, ignored by WithIgnoreErrors or discarded by WithBeforeSend.
+	DropReasonClient DropReason = "client"
+)
+
+func (w *Writer) drop(reason DropReason) {
+	w.dropped.Add(1)
+	if w.onDrop != nil {
+		w.onDrop(reason)
+	}
+}
+
+// DroppedEvents returns the number of events that were not sent.
+func (w *Writer) DroppedEvents() uint64 {
+	return w.dropped.Load()
+}
+
+// Hub returns the hub events are sent through, e.g. to add breadcrumbs or configure the scope directly.
+// Mutating the hub scope affects all events written through the writer.
+func (w *Writer) Hub() *sentry.Hub {
+	return w.hub
+}
+
+// WithScope returns a copy of the writer bound to a clone of its hub, so scope changes,
+// e.g. request specific tags, do not leak into events of the parent or sibling writers.
+// The copy shares the configuration, the async queue and the dropped events counter with the parent,
+// only the parent should be closed.
+func (w *Writer) WithScope() *Writer {
+	scoped := *w
+	scoped.hub = w.hub.Clone()
+	return &scoped
+}
+
+// Flush waits until pending events are delivered or the timeout is reached
+// and reports whether all events were delivered. Unlike Close the writer
+// remains usable, events still queued by WithAsync are not awaited.
+func (w *Writer) Flush(timeout time.Duration) bool {
+	return w.flush(timeout)
+}
+
+// Close forces client to flush all pending events.
+// Can be useful before application exits.
+func (w *Writer) Close() error {
+	if w.async != nil {
+		w.async.close()
+	}
+
+	w.flush(w.flushTimeout)
+	return nil
+}
+
+// CloseContext is like Close but returns the context error as soon as the context is done,
+// e.g. when the graceful shutdown deadline is exceeded, instead of waiting for the flush timeout.
+func (w *Writer) CloseContext(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_ = w.Close()
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// parses the log level from the encoded log
+func (w *Writer) parseLogLevel(data []byte) (zerolog.Level, error) {
+	lvlStr, err := jsonparser.GetUnsafeString(data, w.fieldNames.Load().level)
+	if err != nil {
+		// jsonparser does not tell a missing level from a line which is not an object
+		if (w.strictParsing || w.debugWriter != nil) && (!errors.Is(err, jsonparser.KeyPathNotFoundError) || objectError(data) != nil) {
+			return zerolog.Disabled, ErrMalformedLogEvent
+		}
+		if w.defaultLevel != nil {
+			return *w.defaultLevel, nil
+		}
+		return zerolog.Disabled, nil
+	}
+
+	lvl, err := zerolog.ParseLevel(lvlStr)
+	if err != nil && w.defaultLevel != nil {
+		return *w.defaultLevel, nil
+	}
+
+	return lvl, err
+}
+
+// parses the event except the log level
+func (w *Writer) parseLogEvent(data []byte) (*sentry.Event, bool) {
+	return w.parseEvent(data, false)
+}
+
+// parses the event keeping errors as extra instead of exceptions when messageOnly is set
+func (w *Writer) parseEvent(data []byte, messageOnly bool) (*sentry.Event, bool) {
+	names := w.fieldNames.Load()
+
+	event := sentry.Event{
+		Timestamp: now(),
+		Logger:    w.loggerName,
+		Platform:  w.platform,
+		Extra:     make(map[string]interface{}),
+	}
+
+	if len(w.defaultTags) > 0 {
+		event.Tags = make(map[string]string, len(w.defaultTags))
+		for k, v := range w.defaultTags {
+			event.Tags[k] = v
+		}
+	}
+	event.Contexts = w.newDefaultContexts()
+
+	scratch := scratchPool.Get().(*parseScratch)
+	defer scratch.release()
+
+	var (
+		message           string
+		exceptions        = scratch.exceptions[:0]
+		errorStack        *sentry.Stacktrace
+		rawStack          string
+		causes            []sentry.Exception
+		traceCtx          sentry.TraceContext
+		rawSpanID         string
+		rawParentSpanID   string
+		caller            *sentry.Frame
+		fieldsFingerprint []string
+		fingerprint       []string
+		fingerprintSeen   bool
+		errorType         string
+		extra             extraBudget
+	)
+
+	err := jsonparser.ObjectEach(data, func(key, value []byte, vt jsonparser.ValueType, offset int) error {
+		redacted := w.redacted(key)
+		value, vt = w.redactField(key, value, vt)
+		if !redacted && len(w.redactPatterns) > 0 {
+			value = w.mask(value, vt)
+		}
+
+		// the first fingerprint field wins, a redacted one falls back to the default fingerprint
+		if !fingerprintSeen && string(key) == fingerprintField {
+			fingerprintSeen = true
+			if !redacted {
+				fingerprint = parseFingerprint(value, vt)
+			}
+		}
+
+		val := bytesToStrUnsafe(value)
+		if idx, ok := w.fingerprintFields[string(key)]; ok {
+			if fieldsFingerprint == nil {
+				fieldsFingerprint = scratch.fingerprintFields(len(w.fingerprintFields))
+			}
+			fieldsFingerprint[idx] = val
+		}
+
+		switch string(key) {
+		case names.message:
+			message = w.truncateMessage(val)
+			val = message
+			if w.fingerprintStrategy == FingerprintFromMessage {
+				event.Fingerprint = append(event.Fingerprint, val)
+			}
+		case names.error:
+			if messageOnly {
+				w.addExtra(&event, &extra, string(key), val, len(value))
+				if w.fingerprintStrategy != FingerprintFromStacktrace {
+					event.Fingerprint = append(event.Fingerprint, val)
+				}
+				return nil
+			}
+			exceptions = append(exceptions, sentry.Exception{
+				Value: val,
+			})
+			if w.fingerprintStrategy != FingerprintFromStacktrace {
+				event.Fingerprint = append(event.Fingerprint, val)
+			}
+		case names.errorStack:
+			if st, ok := parseErrorStack(value, vt); ok && !w.withoutStacktrace {
+				errorStack, rawStack = st, val
+				return nil
+			}
+			w.addExtra(&event, &extra, string(key), val, len(value))
+		case names.caller:
+			if w.callerFrame {
+				if frame, ok := parseCaller(val); ok {
+					caller = &frame
+					return nil
+				}
+			}
+			w.addExtra(&event, &extra, string(key), val, len(value))
+		case names.timestamp:
+			if w.logTimestamp {
+				if ts, ok := parseTimestamp(value, vt, w.unixTimestampPrecision); ok {
+					event.Timestamp = ts
+				}
+			}
+		case names.level:
+			// skip
+		case w.userFields.ID:
+			setUserField(&event.User.ID, val)
+			if !w.withoutUserExtra {
+				w.addExtra(&event, &extra, string(key), val, len(value))
+			}
+		case w.userFields.Email:
+			setUserField(&event.User.Email, val)
+			if !w.withoutUserExtra {
+				w.addExtra(&event, &extra, string(key), val, len(value))
+			}
+		case w.userFields.Username:
+			setUserField(&event.User.Username, val)
+			if !w.withoutUserExtra {
+				w.addExtra(&event, &extra, string(key), val, len(value))
+			}
+		case w.userFields.IPAddress:
+			setUserField(&event.User.IPAddress, val)
+			if !w.withoutUserExtra {
+				w.addExtra(&event, &extra, string(key), val, len(value))
+			}
+		default:
+			if w.errorTypeField != "" && string(key) == w.errorTypeField {
+				errorType = val
+				return nil
+			}
+			if w.transactionField != "" && string(key) == w.transactionField {
+				event.Transaction = val
+				return nil
+			}
+			if w.serverNameField != "" && string(key) == w.serverNameField {
+				event.ServerName = val
+				return nil
+			}
+			if w.environmentField != "" && string(key) == w.environmentField {
+				event.Environment = val
+				return nil
+			}
+			if w.breadcrumbsField != "" && string(key) == w.breadcrumbsField {
+				if breadcrumbs, ok := w.parseBreadcrumbs(value, vt); ok {
+					event.Breadcrumbs = append(event.Breadcrumbs, breadcrumbs...)
+					return nil
+				}
+			}
+			if w.httpRequestFields != nil && w.setHTTPRequestField(&event, string(key), val, value, vt) {
+				return nil
+			}
+			if idx, isError := w.errorFields[string(key)]; isError && !messageOnly {
+				if causes == nil {
+					causes = scratch.causeSlots(len(w.errorFields))
+				}
+				causes[idx] = sentry.Exception{
+					Type:  string(key),
+					Value: val,
+				}
+				return nil
+			}
+			if w.traceIDField != "" && string(key) == w.traceIDField && decodeHexID(traceCtx.TraceID[:], val) {
+				return nil
+			}
+			if w.spanIDField != "" && string(key) == w.spanIDField && decodeHexID(traceCtx.SpanID[:], val) {
+				rawSpanID = val
+				return nil
+			}
+			if w.parentSpanIDField != "" && string(key) == w.parentSpanIDField && decodeHexID(traceCtx.ParentSpanID[:], val) {
+				rawParentSpanID = val
+				return nil
+			}
+			if _, isTag := w.tagFields[string(key)]; isTag {
+				if event.Tags == nil {
+					event.Tags = make(map[string]string)
+				}
+				event.Tags[string(key)] = val
+				return nil
+			}
+			if w.tagPrefix != "" && len(key) > len(w.tagPrefix) && strings.HasPrefix(string(key), w.tagPrefix) {
+				if event.Tags == nil {
+					event.Tags = make(map[string]string)
+				}
+				event.Tags[string(key[len(w.tagPrefix):])] = val
+				return nil
+			}
+			parsed := w.parseValue(value, vt)
+			if obj, isObject := parsed.(map[string]interface{}); isObject {
+				if name, isContext := w.contextFields[string(key)]; isContext {
+					setContext(&event, name, obj)
+					return nil
+				}
+				if _, isContext := knownContexts[string(key)]; isContext {
+					setContext(&event, string(key), obj)
+					return nil
+				}
+			}
+			w.addExtra(&event, &extra, string(key), parsed, len(value))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, false
+	}
+
+	if fieldsFingerprint != nil {
+		event.Fingerprint = event.Fingerprint[:0]
+		for _, val := range fieldsFingerprint {
+			if val != "" {
+				event.Fingerprint = append(event.Fingerprint, val)
+			}
+		}
+	}
+
+	explicitFingerprint := false
+	if len(fingerprint) > 0 {
+		event.Fingerprint = fingerprint
+		explicitFingerprint = true
+	}
+
+	if traceCtx.TraceID != (sentry.TraceID{}) {
+		if traceCtx.SpanID == (sentry.SpanID{}) {
+			// sentry does not link events with a zero span id to the trace
+			_, _ = cryptorand.Read(traceCtx.SpanID[:])
+		}
+		setContext(&event, "trace", traceCtx.Map())
+	} else {
+		if rawSpanID != "" {
+			w.addExtra(&event, &extra, w.spanIDField, rawSpanID, len(rawSpanID))
+		}
+		if rawParentSpanID != "" {
+			w.addExtra(&event, &extra, w.parentSpanIDField, rawParentSpanID, len(rawParentSpanID))
+		}
+	}
+
+	var stacktrace *sentry.Stacktrace
+	if len(exceptions) > 0 {
+		// prefer the stack embedded by zerolog.ErrorStackMarshaler, it points to the error origin
+		stacktrace = errorStack
+		if stacktrace == nil {
+			stacktrace = w.newStacktrace()
+		}
+		w.markInApp(stacktrace)
+	} else if errorStack != nil {
+		w.addExtra(&event, &extra, names.errorStack, rawStack, len(rawStack))
+	}
+
+	if extra.truncated {
+		event.Extra["_truncated"] = true
+	}
+
+	if caller != nil {
+		if stacktrace != nil {
+			stacktrace.Frames = appendCallerFrame(stacktrace.Frames, *caller)
+		} else if event.Transaction == "" {
+			event.Transaction = caller.AbsPath + ":" + strconv.Itoa(caller.Lineno)
+		}
+	}
+
+	event.Message = message
+	// causes go first, so the primary error is rendered as the top exception
+	for _, exc := range causes {
+		// the type holds the field name, unset slots are empty
+		if exc.Type != "" {
+			event.Exception = append(event.Exception, exc)
+		}
+	}
+	for _, exc := range exceptions {
+		// the message field may be missing, e.g. renamed by zerolog.MessageFieldName before the writer was created
+		exc.Type = message
+		if errorType != "" {
+			exc.Type = errorType
+		} else if exc.Type == "" {
+			exc.Type = exc.Value
+		}
+		exc.Stacktrace = stacktrace
+		event.Exception = append(event.Exception, exc)
+	}
+
+	// keep the grown slice for the next parse
+	scratch.exceptions = exceptions
+
+	if w.fingerprintFunc != nil && fieldsFingerprint == nil && !explicitFingerprint {
+		event.Fingerprint = w.fingerprintFunc(&event)
+	}
+
+	if w.eventMutator != nil {
+		w.eventMutator(&event, data)
+	}
+
+	return &event, true
+}
+
+// parseScratch holds the slices used while parsing a log line. They are copied into the event,
+// so unlike the event and its Extra, which the client and transports may retain, they can be reused.
+type parseScratch struct {
+	exceptions  []sentry.Exception
+	causes      []sentry.Exception
+	fingerprint []string
+}
+
+var scratchPool = sync.Pool{
+	New: func() interface{} { return &parseScratch{} },
+}
+
+// returns n empty cause slots
+func (s *parseScratch) causeSlots(n int) []sentry.Exception {
+	if cap(s.causes) < n {
+		s.causes = make([]sentry.Exception, n)
+	}
+	return s.causes[:n]
+}
+
+// returns n empty fingerprint slots
+func (s *parseScratch) fingerprintFields(n int) []string {
+	if cap(s.fingerprint) < n {
+		s.fingerprint = make([]string, n)
+	}
+	return s.fingerprint[:n]
+}
+
+// clears the slices, so pooled scratch does not keep parsed buffers alive, and returns it to the pool
+func (s *parseScratch) release() {
+	s.exceptions = s.exceptions[:cap(s.exceptions)]
+	for i := range s.exceptions {
+		s.exceptions[i] = sentry.Exception{}
+	}
+	for i := range s.causes {
+		s.causes[i] = sentry.Exception{}
+	}
+	for i := range s.fingerprint {
+		s.fingerprint[i] = ""
+	}
+	s.exceptions = s.exceptions[:0]
+	scratchPool.Put(s)
+}
+
+// extraBudget tracks the extra added within WithMaxExtraBytes and WithMaxExtraFields limits.
+type extraBudget struct {
+	fields    int
+	bytes     int
+	truncated bool
+}
+
+// adds the extra value of the raw size within the limits,
+// oversized strings are truncated and values beyond the limits dropped
+func (w *Writer) addExtra(event *sentry.Event, budget *extraBudget, key string, value interface{}, size int) {
+	if w.maxExtraFields > 0 && budget.fields >= w.maxExtraFields {
+		budget.truncated = true
+		return
+	}
+
+	if w.maxExtraBytes > 0 {
+		left := w.maxExtraBytes - budget.bytes
+		if size > left {
+			budget.truncated = true
+			s, isString := value.(string)
+			if !isString || left <= 0 {
+				return
+			}
+			truncated := truncateMarked(s, left)
+			value, size = truncated, len(truncated)
+		}
+		budget.bytes += size
+	}
+
+	budget.fields++
+	event.Extra[key] = value
+}
+
+// cuts the message to WithMaxMessageBytes
+func (w *Writer) truncateMessage(message string) string {
+	if w.maxMessageBytes > 0 && len(message) > w.maxMessageBytes {
+		return truncateMarked(message, w.maxMessageBytes)
+	}
+	return message
+}
+
+// truncatedMarker ends values truncated by the writer.
+const truncatedMarker = "…"
+
+// cuts the string to at most n bytes without splitting runes
+func truncateString(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
+
+// cuts the string to at most n bytes including truncatedMarker, the marker is left out if it does not fit
+func truncateMarked(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	if n <= len(truncatedMarker) {
+		return truncateString(s, n)
+	}
+	return truncateString(s, n-len(truncatedMarker)) + truncatedMarker
+}
+
+// fingerprintField holds the explicit fingerprint of the log line.
+const fingerprintField = "fingerprint"
+
+// parses the explicit fingerprint value, either a string or an array of strings
+func parseFingerprint(value []byte, vt jsonparser.ValueType) []string {
+	switch vt {
+	case jsonparser.String:
+		if fingerprint, err := jsonparser.ParseString(value); err == nil && fingerprint != "" {
+			return []string{fingerprint}
+		}
+	case jsonparser.Array:
+		var fingerprint []string
+		_, _ = jsonparser.ArrayEach(value, func(item []byte, vt jsonparser.ValueType, offset int, err error) {
+			if vt != jsonparser.String {
+				return
+			}
+			if s, err := jsonparser.ParseString(item); err == nil && s != "" {
+				fingerprint = append(fingerprint, s)
+			}
+		})
+		return fingerprint
+	}
+
+	return nil
+}
+
+// parses the stack rendered by github.com/rs/zerolog/pkgerrors.MarshalStack,
+// e.g. [{"func":"foo","line":"42","source":"foo.go"}], innermost frame first
+func parseErrorStack(value []byte, vt jsonparser.ValueType) (*sentry.Stacktrace, bool) {
+	if vt != jsonparser.Array {
+		return nil, false
+	}
+
+	var (
+		frames []sentry.Frame
+		failed bool
+	)
+
+	_, err := jsonparser.ArrayEach(value, func(item []byte, vt jsonparser.ValueType, offset int, err error) {
+		if failed || vt != jsonparser.Object {
+			failed = true
+			return
+		}
+
+		source, _ := jsonparser.GetString(item, "source")
+		function, _ := jsonparser.GetString(item, "func")
+		line, _ := jsonparser.GetString(item, "line")
+		if source == "" && function == "" {
+			failed = true
+			return
+		}
+
+		lineno, _ := strconv.Atoi(line)
+		frames = append(frames, sentry.Frame{
+			Function: function,
+			Filename: source,
+			Lineno:   lineno,
+		})
+	})
+	if err != nil || failed || len(frames) == 0 {
+		return nil, false
+	}
+
+	// sentry expects the outermost frame first
+	for i, j := 0, len(frames)-1; i < j; i, j = i+1, j-1 {
+		frames[i], frames[j] = frames[j], frames[i]
+	}
+
+	return &sentry.Stacktrace{Frames: frames}, true
+}
+
+// parses the timestamp encoded according to zerolog.TimeFieldFormat,
+// numbers are treated as UNIX time of the given precision, or the one implied by the format if zero
+func parseTimestamp(value []byte, vt jsonparser.ValueType, precision time.Duration) (time.Time, bool) {
+	if vt == jsonparser.Number {
+		if precision <= 0 {
+			precision = unixTimestampPrecision(zerolog.TimeFieldFormat)
+		}
+
+		if i, err := jsonparser.ParseInt(value); err == nil {
+			return time.Unix(0, i*int64(precision)), true
+		}
+		if f, err := jsonparser.ParseFloat(value); err == nil {
+			return time.Unix(0, int64(f*float64(precision))), true
+		}
+		return time.Time{}, false
+	}
+
+	if vt != jsonparser.String {
+		return time.Time{}, false
+	}
+
+	switch zerolog.TimeFieldFormat {
+	case zerolog.TimeFormatUnix, zerolog.TimeFormatUnixMs, zerolog.TimeFormatUnixMicro, zerolog.TimeFormatUnixNano:
+		return time.Time{}, false
+	}
+
+	ts, err := time.Parse(zerolog.TimeFieldFormat, bytesToStrUnsafe(value))
+	if err != nil {
+		return time.Time{}, false
+	}
+
+	return ts, true
+}
+
+func unixTimestampPrecision(format string) time.Duration {
+	switch format {
+	case zerolog.TimeFormatUnixMs:
+		return time.Millisecond
+	case zerolog.TimeFormatUnixMicro:
+		return time.Microsecond
+	case zerolog.TimeFormatUnixNano:
+		return time.Nanosecond
+	default:
+		return time.Second
+	}
+}
+
+// parses zerolog caller formatted as file:line
+func parseCaller(val string) (sentry.Frame, bool) {
+	idx := strings.LastIndexByte(val, ':')
+	if idx <= 0 {
+		return sentry.Frame{}, false
+	}
+
+	lineno, err := strconv.Atoi(val[idx+1:])
+	if err != nil {
+		return sentry.Frame{}, false
+	}
+
+	return sentry.Frame{
+		Filename: filepath.Base(val[:idx]),
+		AbsPath:  val[:idx],
+		Lineno:   lineno,
+		InApp:    true,
+	}, true
+}
+
+// appends the caller as the top in-app frame unless the top frame already points to it
+func appendCallerFrame(frames []sentry.Frame, caller sentry.Frame) []sentry.Frame {
+	if n := len(frames); n > 0 && frames[n-1].AbsPath == caller.AbsPath && frames[n-1].Lineno == caller.Lineno {
+		frames[n-1].InApp = true
+		return frames
+	}
+
+	return append(frames, caller)
+}
+
+// decodes hex encoded trace or span id, dst is left untouched on failure
+func decodeHexID(dst []byte, val string) bool {
+	if hex.DecodedLen(len(val)) != len(dst) {
+		return false
+	}
+
+	id := make([]byte, len(dst))
+	if _, err := hex.Decode(id, []byte(val)); err != nil {
+		return false
+	}
+	copy(dst, id)
+
+	return true
+}
+
+// decodes the object redacting nested fields of WithRedactFields
+func (w *Writer) parseObject(value []byte) (map[string]interface{}, bool) {
+	obj := make(map[string]interface{})
+	err := jsonparser.ObjectEach(value, func(key, value []byte, vt jsonparser.ValueType, offset int) error {
+		value, vt = w.redactField(key, value, vt)
+		obj[string(key)] = w.parseValue(value, vt)
+		return nil
+	})
+	if err != nil {
+		return nil, false
+	}
+
+	return obj, true
+}
+
+// parses the array of objects into breadcrumbs
+func (w *Writer) parseBreadcrumbs(value []byte, vt jsonparser.ValueType) ([]*sentry.Breadcrumb, bool) {
+	if vt != jsonparser.Array {
+		return nil, false
+	}
+
+	var (
+		breadcrumbs []*sentry.Breadcrumb
+		valid       = true
+	)
+	_, err := jsonparser.ArrayEach(value, func(item []byte, itemType jsonparser.ValueType, _ int, _ error) {
+		if !valid || itemType != jsonparser.Object {
+			valid = false
+			return
+		}
+
+		breadcrumb := &sentry.Breadcrumb{}
+		err := jsonparser.ObjectEach(item, func(key, value []byte, vt jsonparser.ValueType, _ int) error {
+			value, vt = w.redactField(key, value, vt)
+			val := bytesToStrUnsafe(value)
+			switch string(key) {
+			case "message":
+				breadcrumb.Message = val
+			case "category":
+				breadcrumb.Category = val
+			case "level":
+				if lvl, err := zerolog.ParseLevel(val); err == nil {
+					breadcrumb.Level = w.levelsMapping[lvl]
+				} else {
+					breadcrumb.Level = sentry.Level(val)
+				}
+			case "timestamp":
+				if ts, ok := parseTimestamp(value, vt, w.unixTimestampPrecision); ok {
+					breadcrumb.Timestamp = ts
+				}
+			default:
+				if breadcrumb.Data == nil {
+					breadcrumb.Data = make(map[string]interface{})
+				}
+				breadcrumb.Data[string(key)] = w.parseValue(value, vt)
+			}
+			return nil
+		})
+		if err != nil {
+			valid = false
+			return
+		}
+
+		breadcrumbs = append(breadcrumbs, breadcrumb)
+	})
+	if err != nil || !valid {
+		return nil, false
+	}
+
+	return breadcrumbs, true
+}
+
+// only the first occurrence of the user field is taken
+func setUserField(dst *string, val string) {
+	if *dst == "" {
+		*dst = val
+	}
+}
+
+// Redacted replaces values of fields configured by WithRedactFields.
+const Redacted = "[REDACTED]"
+
+var redactedValue = []byte(Redacted)
+
+// reports whether the field value has to be redacted
+func (w *Writer) redacted(key []byte) bool {
+	for _, name := range w.redactFields {
+		if strings.EqualFold(bytesToStrUnsafe(key), name) {
+			return true
+		}
+	}
+	return false
+}
+
+// redacts the value of the field or, for arrays kept as raw json, the values of nested fields
+func (w *Writer) redactField(key, value []byte, vt jsonparser.ValueType) ([]byte, jsonparser.ValueType) {
+	if w.redacted(key) {
+		return redactedValue, jsonparser.String
+	}
+	if vt == jsonparser.Array && w.hasRedactedField(value, vt) {
+		if redacted, err := json.Marshal(w.decodeRedacted(value, vt)); err == nil {
+			return redacted, vt
+		}
+		return redactedValue, jsonparser.String
+	}
+	return value, vt
+}
+
+// reports whether the value contains a field of WithRedactFields at any depth
+func (w *Writer) hasRedactedField(value []byte, vt jsonparser.ValueType) bool {
+	if len(w.redactFields) == 0 {
+		return false
+	}
+
+	found := false
+	switch vt {
+	case jsonparser.Object:
+		_ = jsonparser.ObjectEach(value, func(key, value []byte, vt jsonparser.ValueType, _ int) error {
+			found = found || w.redacted(key) || w.hasRedactedField(value, vt)
+			return nil
+		})
+	case jsonparser.Array:
+		_, _ = jsonparser.ArrayEach(value, func(item []byte, vt jsonparser.ValueType, _ int, _ error) {
+			found = found || w.hasRedactedField(item, vt)
+		})
+	}
+	return found
+}
+
+// decodes the value like parseValue, but arrays too, so it can be encoded again without redacted fields
+func (w *Writer) decodeRedacted(value []byte, vt jsonparser.ValueType) interface{} {
+	switch vt {
+	case jsonparser.Object:
+		obj := make(map[string]interface{})
+		_ = jsonparser.ObjectEach(value, func(key, value []byte, vt jsonparser.ValueType, _ int) error {
+			if w.redacted(key) {
+				obj[string(key)] = Redacted
+			} else {
+				obj[string(key)] = w.decodeRedacted(value, vt)
+			}
+			return nil
+		})
+		return obj
+	case jsonparser.Array:
+		arr := []interface{}{}
+		_, _ = jsonparser.ArrayEach(value, func(item []byte, vt jsonparser.ValueType, _ int, _ error) {
+			arr = append(arr, w.decodeRedacted(item, vt))
+		})
+		return arr
+	case jsonparser.String:
+		if s, err := jsonparser.ParseString(value); err == nil {
+			return s
+		}
+	}
+	return w.parseValue(value, vt)
+}
+
+// replaces matches of patterns configured by WithRedactPatterns in string values,
+// objects and arrays are masked as raw json and kept as strings if the result is not valid json
+func (w *Writer) mask(value []byte, vt jsonparser.ValueType) []byte {
+	switch vt {
+	case jsonparser.String, jsonparser.Object, jsonparser.Array:
+	default:
+		return value
+	}
+
+	for _, re := range w.redactPatterns {
+		if re.Match(value) {
+			value = re.ReplaceAll(value, redactedValue)
+		}
+	}
+
+	return value
+}
+
+// object fields sent as Sentry contexts instead of extra
+var knownContexts = map[string]struct{}{
+	"http":    {},
+	"request": {},
+	"os":      {},
+	"runtime": {},
+}
+
+// populates the event request from the http field and reports whether the key is mapped
+func (w *Writer) setHTTPRequestField(event *sentry.Event, key, val string, value []byte, vt jsonparser.ValueType) bool {
+	fields := w.httpRequestFields
+	switch key {
+	case "":
+		return false
+	case fields.Method:
+		httpRequest(event).Method = val
+	case fields.URL:
+		req := httpRequest(event)
+		req.URL = val
+		if idx := strings.IndexByte(val, '?'); idx >= 0 {
+			req.URL, req.QueryString = val[:idx], val[idx+1:]
+		}
+	case fields.UserAgent:
+		req := httpRequest(event)
+		if req.Headers == nil {
+			req.Headers = make(map[string]string)
+		}
+		req.Headers["User-Agent"] = val
+	case fields.StatusCode:
+		setContext(event, "response", sentry.Context{"status_code": w.parseValue(value, vt)})
+	default:
+		return false
+	}
+
+	return true
+}
+
+func httpRequest(event *sentry.Event) *sentry.Request {
+	if event.Request == nil {
+		event.Request = &sentry.Request{}
+	}
+	return event.Request
+}
+
+// copies the contexts of WithDefaultContexts, so events do not share them
+func (w *Writer) newDefaultContexts() map[string]sentry.Context {
+	if len(w.defaultContexts) == 0 {
+		return nil
+	}
+
+	contexts := make(map[string]sentry.Context, len(w.defaultContexts))
+	for name, ctx := range w.defaultContexts {
+		copied := make(sentry.Context, len(ctx))
+		for k, v := range ctx {
+			copied[k] = v
+		}
+		contexts[name] = copied
+	}
+	return contexts
+}
+
+func setContext(event *sentry.Event, key string, ctx sentry.Context) {
+	if event.Contexts == nil {
+		event.Contexts = make(map[string]sentry.Context)
+	}
+	event.Contexts[key] = ctx
+}
+
+// parses the json value keeping its type, objects are decoded recursively, arrays stay raw strings
+func (w *Writer) parseValue(value []byte, vt jsonparser.ValueType) interface{} {
+	switch vt {
+	case jsonparser.Object:
+		if obj, ok := w.parseObject(value); ok {
+			return obj
+		}
+	case jsonparser.Number:
+		if i, err := jsonparser.ParseInt(value); err == nil {
+			return i
+		}
+		if f, err := jsonparser.ParseFloat(value); err == nil {
+			return f
+		}
+	case jsonparser.Boolean:
+		if b, err := jsonparser.ParseBoolean(value); err == nil {
+			return b
+		}
+	case jsonparser.Null:
+		return nil
+	}
+
+	return bytesToStrUnsafe(value)
+}
+
+// import path of the current package, resolved at runtime so forks and vendored copies are trimmed too
+var module = reflect.TypeOf(Writer{}).PkgPath()
+
+func (w *Writer) newStacktrace() *sentry.Stacktrace {
+	if w.withoutStacktrace {
+		return nil
+	}
+
+	if w.maxStacktraceDepth > 0 {
+		return w.newLimitedStacktrace()
+	}
+
+	st := sentry.NewStacktrace()
+	st.Frames = trimFrames(st.Frames, w.stacktraceSkipModules)
+
+	return st
+}
+
+// maxCallers is the number of calls captured by sentry.NewStacktrace.
+const maxCallers = 100
+
+// captures the same frames as sentry.NewStacktrace and trimFrames do, but only converts the frames kept
+// within WithMaxStacktraceDepth, nearest the call point, so deep stacks do not materialize frames that are cut anyway
+func (w *Writer) newLimitedStacktrace() *sentry.Stacktrace {
+	var pcs [maxCallers]uintptr
+	n := runtime.Callers(1, pcs[:])
+	if n == 0 {
+		return nil
+	}
+
+	// the first pass only gets the modules, function names are not copied
+	modules := make([]string, 0, n)
+	frames := runtime.CallersFrames(pcs[:n])
+	for more := true; more; {
+		var frame runtime.Frame
+		frame, more = frames.Next()
+		if pkg := packageName(frame.Function); !internalModule(pkg) {
+			modules = append(modules, pkg)
+		}
+	}
+
+	// modules are ordered from the innermost call, trimming expects the outermost first
+	end := trimmedLen(len(modules), func(i int) string { return modules[len(modules)-1-i] }, w.stacktraceSkipModules)
+	start := end - w.maxStacktraceDepth
+	if start < 0 {
+		start = 0
+	}
+
+	st := &sentry.Stacktrace{Frames: make([]sentry.Frame, end-start)}
+	frames = runtime.CallersFrames(pcs[:n])
+	// index of the frame from the outermost call
+	for i, more := len(modules)-1, true; more && i >= start; {
+		var frame runtime.Frame
+		frame, more = frames.Next()
+		if internalModule(packageName(frame.Function)) {
+			continue
+		}
+		if i < end {
+			st.Frames[i-start] = sentry.NewFrame(frame)
+		}
+		i--
+	}
+
+	return st
+}
+
+// reports whether frames of the module are dropped by sentry.NewStacktrace
+func internalModule(pkg string) bool {
+	return pkg == "runtime" || pkg == "testing" ||
+		strings.HasPrefix(pkg, "github.com/getsentry/sentry-go") && !strings.HasSuffix(pkg, "_test")
+}
+
+// returns the package of the qualified function name, like sentry.NewFrame does
+func packageName(function string) string {
+	// compiler generated symbols do not belong to a package
+	if strings.HasPrefix(function, "go.") || strings.HasPrefix(function, "type.") {
+		return ""
+	}
+
+	pathEnd := strings.LastIndex(function, "/")
+	if pathEnd < 0 {
+		pathEnd = 0
+	}
+	if i := strings.Index(function[pathEnd:], "."); i >= 0 {
+		return function[:pathEnd+i]
+	}
+	return ""
+}
+
+// drops frames above the logger call point, frames are ordered from the outermost call
+func trimFrames(frames []sentry.Frame, skipModules []string) []sentry.Frame {
+	return frames[:trimmedLen(len(frames), func(i int) string { return frames[i].Module }, skipModules)]
+}
+
+// returns the number of frames kept by trimFrames out of n frames of the modules
+func trimmedLen(n int, moduleOf func(i int) string, skipModules []string) int {
+	const loggerModule = "github.com/rs/zerolog"
+
+	if n == 0 {
+		return 0
+	}
+
+	threshold := n - 1
+	// drop current module frames
+	for ; threshold > 0 && moduleOf(threshold) == module; threshold-- {
+	}
+
+outer:
+	// try to drop zerolog module frames after logger call point
+	for i := threshold; i > 0; i-- {
+		if moduleOf(i) == loggerModule {
+			for j := i - 1; j >= 0; j-- {
+				if moduleOf(j) != loggerModule {
+					threshold = j
+					break outer
+				}
+			}
+
+			break
+		}
+	}
+
+	// drop user defined wrapper frames, e.g. logging facades
+	for ; threshold > 0 && hasAnyPrefix(moduleOf(threshold), skipModules); threshold-- {
+	}
+
+	return threshold + 1
+}
+
+// marks frames of the in-app modules as in-app and others as not,
+// the stacktrace is left to the Sentry heuristics when no modules are configured
+func (w *Writer) markInApp(st *sentry.Stacktrace) {
+	if st == nil || len(w.inAppModules) == 0 {
+		return
+	}
+
+	for i := range st.Frames {
+		// frames parsed from the error stack field have no module to tell
+		if st.Frames[i].Module != "" {
+			st.Frames[i].InApp = hasAnyPrefix(st.Frames[i].Module, w.inAppModules)
+		}
+	}
+}
+
+func hasAnyPrefix(s string, prefixes []string) bool {
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(s, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func bytesToStrUnsafe(data []byte) string {
+	return *(*string)(unsafe.Pointer(&data))
+}
+
+// WriterOption configures sentry events writer.
+type WriterOption interface {
+	apply(*config)
+}
+
+type optionFunc func(*config)
+
+func (fn optionFunc) apply(c *config) { fn(c) }
+
+type EventHintCallback func(event *sentry.Event, hint *sentry.EventHint) *sentry.Event
+
+// EventMutator is called with the event parsed from the raw log line before it is captured.
+type EventMutator func(event *sentry.Event, raw []byte)
+
+// DropFunc reports whether the log line of the level with the decoded fields should be dropped.
+// Field values may reference the buffer passed to Write and must not be retained.
+type DropFunc func(level zerolog.Level, fields map[string]interface{}) bool
+
+type config struct {
+	levels            []zerolog.Level
+	levelsMapping     map[zerolog.Level]sentry.Level
+	sampleRate        float64
+	release           string
+	releaseBuildInfo  bool
+	dist              string
+	environment       string
+	environmentEnv    string
+	serverName        string
+	ignoreErrors      []string
+	ignoreMessages    []string
+	dropFunc          DropFunc
+	runtimeContext    bool
+	memStatsRate      float64
+	rawHint           bool
+	debug             bool
+	tracing           bool
+	debugWriter       io.Writer
+	httpProxy         string
+	httpsProxy        string
+	caCerts           *x509.CertPool
+	httpClient        *http.Client
+	clientOptionFuncs []func(*sentry.ClientOptions)
+	httpTransport     http.RoundTripper
+	compression       bool
+	transport         sentry.Transport
+	syncTransport     bool
+	projects          []levelProject
+	flushTimeout      time.Duration
+	fatalFlush        *time.Duration
+	beforeSend        sentry.EventProcessor
+	beforeSendTx      sentry.EventProcessor
+	tracesSampleRate  float64
+	tagFields         []string
+	tagPrefix         string
+	defaultTags       map[string]string
+	defaultContexts   map[string]sentry.Context
+	levelTag          string
+	k8sContext        bool
+	skipModules       []string
+	inAppModules      []string
+	maxStackDepth     int
+	maxExtraBytes     int
+	maxExtraFields    int
+	maxMessageBytes   int
+	syntheticExc      bool
+	messageOnlyLevels []zerolog.Level
+	noStacktrace      bool
+	errorFields       []string
+	userFields        UserFieldNames
+	httpFields        *HTTPRequestFields
+	contextFields     map[string]string
+	breadcrumbsField  string
+	errorTypeField    string
+	transactionField  string
+	serverNameField   string
+	environmentField  string
+	noUserExtra       bool
+	breadcrumbLevels  []zerolog.Level
+	maxBreadcrumbs    int
+	attachStacktrace  bool
+	maxErrorDepth     int
+	traceIDField      string
+	spanIDField       string
+	parentSpanIDField string
+	asyncQueueSize    int
+	onDrop            func(reason DropReason)
+	dedupWindow       time.Duration
+	safeCopy          bool
+	callerFrame       bool
+	levelSampleRates  map[zerolog.Level]float64
+	rateLimits        map[zerolog.Level]int
+	loggerName        string
+	platform          string
+	logTimestamp      bool
+	unixTsPrecision   time.Duration
+	fpFields          []string
+	fpStrategy        FingerprintStrategy
+	fpFunc            func(event *sentry.Event) []string
+	eventMutator      EventMutator
+	redactFields      []string
+	redactPatterns    []*regexp.Regexp
+	strictParsing     bool
+	defaultLevel      *zerolog.Level
+}
+
+// WithLevels configures zerolog levels that have to be sent to Sentry.
+// Default levels are: error, fatal, panic.
+func WithLevels(levels ...zerolog.Level) WriterOption {
+	return optionFunc(func(cfg *config) {
+		cfg.levels = levels
+	})
+}
+
+// WithCaptureLevel configures zerolog levels that have to be sent to Sentry as minLevel and the levels above it,
+// e.g. zerolog.WarnLevel sends warn, error, fatal and panic. It replaces the levels of WithLevels,
+// whichever comes last wins. Fatal and panic events are still flushed before the writer returns.
+func WithCaptureLevel(minLevel zerolog.Level) WriterOption {
+	return optionFunc(func(cfg *config) {
+		cfg.levels = nil
+		for level := zerolog.TraceLevel; level <= zerolog.PanicLevel; level++ {
+			if level >= minLevel {
+				cfg.levels = append(cfg.levels, level)
+			}
+		}
+	})
+}
+
+// WithDefaultLevel configures the level of log lines written with Write whose level field is absent or unknown.
+// By default such lines are skipped.
+func WithDefaultLevel(level zerolog.Level) WriterOption {
+	return optionFunc(func(cfg *config) {
+		cfg.defaultLevel = &level
+	})
+}
+
+// WithLevelMapping overrides the mapping of zerolog levels to Sentry levels for this writer,
+// e.g. to distinguish panic from fatal. Levels missing in the mapping keep defaults.
+func WithLevelMapping(mapping map[zerolog.Level]sentry.Level) WriterOption {
+	return optionFunc(func(cfg *config) {
+		cfg.levelsMapping = mapping
+	})
+}
+
+// WithSampleRate configures the sample rate as a percentage of events to be sent in the range of 0.0 to 1.0.
+func WithSampleRate(rate float64) WriterOption {
+	return optionFunc(func(cfg *config) {
+		cfg.sampleRate = rate
+	})
+}
+
+// WithFingerprintFields configures log fields, e.g. "route" and "error_code", whose values make up
+// the event fingerprint in the given order instead of the message and error.
+// An explicit fingerprint field still takes precedence.
+func WithFingerprintFields(names ...string) WriterOption {
+	return optionFunc(func(cfg *config) {
+		cfg.fpFields = names
+	})
+}
+
+// WithoutMessageFingerprint stops adding the message to the event fingerprint, so messages with variable
+// content, e.g. ids, do not split an issue into many groups. The error value is still added,
+// events without an error are grouped by sentry. Explicit fingerprint and WithFingerprintFields still apply.
+// It is a shorthand for WithFingerprintStrategy(FingerprintFromError).
+func WithoutMessageFingerprint() WriterOption {
+	return WithFingerprintStrategy(FingerprintFromError)
+}
+
+// FingerprintStrategy defines the fingerprint of events without an explicit fingerprint field or WithFingerprintFields.
+type FingerprintStrategy int
+
+const (
+	// FingerprintFromMessage makes up the fingerprint of the message and error values, the default.
+	FingerprintFromMessage FingerprintStrategy = iota
+	// FingerprintFromError makes up the fingerprint of the error values only.
+	FingerprintFromError
+	// FingerprintFromStacktrace leaves the fingerprint empty, so sentry groups events by stacktrace.
+	FingerprintFromStacktrace
+)
+
+// WithFingerprintStrategy configures how the event fingerprint is made up, see FingerprintStrategy.
+// An explicit fingerprint field and WithFingerprintFields take precedence over the strategy.
+func WithFingerprintStrategy(strategy FingerprintStrategy) WriterOption {
+	return optionFunc(func(cfg *config) {
+		cfg.fpStrategy = strategy
+	})
+}
+
+// WithFingerprintFunc configures a custom fingerprint of events. The func receives the event
+// with the fingerprint made up by the strategy and returns the one to use, nil leaves grouping to sentry.
+// Like the strategy, it is not used when there is an explicit fingerprint field or a WithFingerprintFields value.
+func WithFingerprintFunc(fn func(event *sentry.Event) []string) WriterOption {
+	return optionFunc(func(cfg *config) {
+		cfg.fpFunc = fn
+	})
+}
+
+// WithLevelSampleRates configures per level sample rates in the range of 0.0 to 1.0, out of range values are clamped.
+// Sampling is done by the writer independently of WithSampleRate, levels without a rate are always sent.
+func WithLevelSampleRates(rates map[zerolog.Level]float64) WriterOption {
+	return optionFunc(func(cfg *config) {
+		cfg.levelSampleRates = rates
+	})
+}
+
+// WithRateLimit limits events of the level to perSecond events per second, allowing bursts of the same size.
+// Events over the limit are dropped, a non-positive limit removes it.
+// Fatal and panic events are exempt, so crashes are always reported.
+func WithRateLimit(level zerolog.Level, perSecond int) WriterOption {
+	return optionFunc(func(cfg *config) {
+		if cfg.rateLimits == nil {
+			cfg.rateLimits = make(map[zerolog.Level]int)
+		}
+		cfg.rateLimits[level] = perSecond
+	})
+}
+
+// WithLoggerName configures the logger name of events. Default value is zerolog.
+func WithLoggerName(name string) WriterOption {
+	return optionFunc(func(cfg *config) {
+		cfg.loggerName = name
+	})
+}
+
+// defaultPlatform is the platform set by the client to every event.
+const defaultPlatform = "go"
+
+// WithPlatform configures the platform of events, e.g. for logs forwarded from services in other languages.
+// Default value is go. Events of other platforms are captured through the hub client, as the client
+// overwrites the platform of events captured by the hub, so the hub LastEventID is not updated for them.
+func WithPlatform(platform string) WriterOption {
+	return optionFunc(func(cfg *config) {
+		cfg.platform = platform
+	})
+}
+
+// WithLogTimestamp configures whether the event timestamp is taken from the log line timestamp field,
+// encoded according to zerolog.TimeFieldFormat. Current time is used when the field is absent or invalid.
+// Disabled by default, so events are stamped with the time they are written.
+func WithLogTimestamp(enabled bool) WriterOption {
+	return optionFunc(func(cfg *config) {
+		cfg.logTimestamp = enabled
+	})
+}
+
+// WithUnixTimestampPrecision configures the precision of numeric timestamps used by WithLogTimestamp,
+// e.g. time.Millisecond for zerolog.TimeFormatUnixMs. By default it is implied by zerolog.TimeFieldFormat.
+func WithUnixTimestampPrecision(precision time.Duration) WriterOption {
+	return optionFunc(func(cfg *config) {
+		cfg.unixTsPrecision = precision
+	})
+}
+
+// WithRelease configures the release to be sent with events.
+// With NewWithHub and NewWithClient the release is set on the events of the writer instead,
+// taking precedence over the release of the client.
+func WithRelease(release string) WriterOption {
+	return optionFunc(func(cfg *config) {
+		cfg.release = release
+	})
+}
+
+// WithReleaseFromBuildInfo configures the release to be the VCS revision embedded into the binary by go build,
+// unless the release is set by WithRelease.
+func WithReleaseFromBuildInfo() WriterOption {
+	return optionFunc(func(cfg *config) {
+		cfg.releaseBuildInfo = true
+	})
+}
+
+// WithDist configures the release distribution to be sent with events.
+func WithDist(dist string) WriterOption {
+	return optionFunc(func(cfg *config) {
+		cfg.dist = dist
+	})
+}
+
+// WithEnvironment configures the environment to be sent with events.
+// With NewWithHub and NewWithClient the environment is set on the events of the writer instead,
+// taking precedence over the environment of the client.
+func WithEnvironment(environment string) WriterOption {
+	return optionFunc(func(cfg *config) {
+		cfg.environment = environment
+	})
+}
+
+// WithEnvironmentFromEnv configures the environment to be read from the given environment variable,
+// unless the environment is set by WithEnvironment.
+func WithEnvironmentFromEnv(name string) WriterOption {
+	return optionFunc(func(cfg *config) {
+		cfg.environmentEnv = name
+	})
+}
+
+// WithLevelTag configures the tag holding the zerolog level of events, e.g. to tell trace from debug
+// or panic from fatal events which share the sentry level. Disabled by default.
+func WithLevelTag(tagName string) WriterOption {
+	return optionFunc(func(cfg *config) {
+		cfg.levelTag = tagName
+	})
+}
+
+// WithK8sContext adds pod_name, pod_namespace and node_name default tags read by New
+// from the POD_NAME, POD_NAMESPACE and NODE_NAME environment variables set by the Kubernetes downward API.
+// Empty variables are omitted and tags set by WithDefaultTags take precedence.
+func WithK8sContext() WriterOption {
+	return optionFunc(func(cfg *config) {
+		cfg.k8sContext = true
+	})
+}
+
+// WithServerName configures the server name field for events. Default value is OS hostname,
+// if it can not be determined the server name is left to the client.
+func WithServerName(serverName string) WriterOption {
+	return optionFunc(func(cfg *config) {
+		cfg.serverName = serverName
+	})
+}
+
+// WithIgnoreErrors configures the list of regexp strings that will be used to match against event's message
+// and if applicable, caught errors type and value. If the match is found, then a whole event will be dropped.
+func WithIgnoreErrors(reList []string) WriterOption {
+	return optionFunc(func(cfg *config) {
+		cfg.ignoreErrors = reList
+	})
+}
+
+// WithIgnoreMessages drops events whose message contains any of the substrings.
+// Unlike WithIgnoreErrors the message is matched by the writer before the event is passed to the client.
+func WithIgnoreMessages(substrings ...string) WriterOption {
+	return optionFunc(func(cfg *config) {
+		cfg.ignoreMessages = substrings
+	})
+}
+
+// WithDropFunc sets a predicate called for parsed log lines of enabled levels, returning true drops the event.
+// Useful for suppression rules spanning several fields, e.g. canceled errors of the cache service.
+func WithDropFunc(drop DropFunc) WriterOption {
+	return optionFunc(func(cfg *config) {
+		cfg.dropFunc = drop
+	})
+}
+
+// WithRuntimeContext adds the go_runtime context with the number of goroutines and CPUs to captured events.
+// As reading memory stats stops the world, the allocated and system memory are added only to
+// the memStatsSampleRate fraction of events, in the range of 0.0 to 1.0.
+func WithRuntimeContext(memStatsSampleRate float64) WriterOption {
+	return optionFunc(func(cfg *config) {
+		cfg.runtimeContext = true
+		cfg.memStatsRate = memStatsSampleRate
+	})
+}
+
+// RawLogLine is the log line an event is parsed from, passed as the hint data, see WithRawLogLineHint.
+type RawLogLine []byte
+
+// WithRawLogLineHint passes the log line of events to WithBeforeSend callbacks and event processors
+// as RawLogLine hint data, so they can parse fields the writer does not keep. The line references
+// the buffer passed to Write, it must not be modified or retained unless copied. Events are then captured
+// through the hub client, as the hub does not pass hints, so the hub LastEventID is not updated.
+func WithRawLogLineHint() WriterOption {
+	return optionFunc(func(cfg *config) {
+		cfg.rawHint = true
+	})
+}
+
+// WithDebug enables sentry client debug logs.
+func WithDebug() WriterOption {
+	return optionFunc(func(cfg *config) {
+		cfg.debug = true
+	})
+}
+
+// WithTracing enables sentry client tracing.
+func WithTracing() WriterOption {
+	return optionFunc(func(cfg *config) {
+		cfg.tracing = true
+	})
+}
+
+// WithTracingSampleRate sets tracing sample rate.
+func WithTracingSampleRate(tsr float64) WriterOption {
+	return optionFunc(func(cfg *config) {
+		cfg.tracesSampleRate = tsr
+	})
+}
+
+// WithBeforeSend sets a callback which is called before event is sent.
+// Extra values of parsed log lines keep their json types: numbers are int64, or float64 when not integers,
+// booleans are bool, objects are map[string]interface{} with values of the same types, null is nil,
+// strings and arrays are strings. See WithRawLogLineHint to get the log line itself.
+func WithBeforeSend(beforeSend sentry.EventProcessor) WriterOption {
+	return optionFunc(func(cfg *config) {
+		cfg.beforeSend = beforeSend
+	})
+}
+
+// WithBeforeSendTransaction sets a callback which is called before transaction is sent,
+// e.g. to drop health check transactions when tracing is enabled.
+func WithBeforeSendTransaction(beforeSendTransaction sentry.EventProcessor) WriterOption {
+	return optionFunc(func(cfg *config) {
+		cfg.beforeSendTx = beforeSendTransaction
+	})
+}
+
+// WithFlushTimeout configures the timeout used to flush pending events on Close and after fatal events.
+// Negative values are ignored and the default of 3 seconds is kept.
+func WithFlushTimeout(timeout time.Duration) WriterOption {
+	return optionFunc(func(cfg *config) {
+		if timeout < 0 {
+			return
+		}
+		cfg.flushTimeout = timeout
+	})
+}
+
+// WithFatalFlushTimeout configures the timeout used to flush pending events after fatal and panic events,
+// e.g. a shorter one so a dying process does not hang on an unreachable Sentry. Defaults to the flush timeout,
+// negative values are ignored.
+func WithFatalFlushTimeout(timeout time.Duration) WriterOption {
+	return optionFunc(func(cfg *config) {
+		if timeout < 0 {
+			return
+		}
+		cfg.fatalFlush = &timeout
+	})
+}
+
+// WithEventMutator sets a callback which is called on every parsed event before it reaches the hub,
+// so it can be enriched or redacted using the raw log line without parsing it again.
+// The raw bytes must not be retained after the callback returns.
+func WithEventMutator(mutator EventMutator) WriterOption {
+	return optionFunc(func(cfg *config) {
+		cfg.eventMutator = mutator
+	})
+}
+
+// WithRedactFields configures log fields, e.g. "password" or "authorization", whose values are replaced
+// by Redacted before they are stored in the event. Field names are matched case-insensitively.
+func WithRedactFields(names ...string) WriterOption {
+	return optionFunc(func(cfg *config) {
+		cfg.redactFields = names
+	})
+}
+
+// WithRedactPatterns configures patterns, e.g. matching emails or card numbers, whose matches in any string
+// value are replaced by Redacted. Patterns run against every field, keep them cheap and free of
+// catastrophic backtracking.
+func WithRedactPatterns(patterns ...*regexp.Regexp) WriterOption {
+	return optionFunc(func(cfg *config) {
+		cfg.redactPatterns = patterns
+	})
+}
+
+// WithDebugWriter configures the writer of sentry client debug logs, see WithDebug.
+// Log lines dropped because they are malformed are reported to it as well.
+func WithDebugWriter(w io.Writer) WriterOption {
+	return optionFunc(func(cfg *config) {
+		cfg.debugWriter = w
+	})
+}
+
+// WithHttpProxy enables sentry client tracing.
+func WithHttpProxy(proxy string) WriterOption {
+	return optionFunc(func(cfg *config) {
+		cfg.httpProxy = proxy
+	})
+}
+
+// WithHttpsProxy enables sentry client tracing.
+func WithHttpsProxy(proxy string) WriterOption {
+	return optionFunc(func(cfg *config) {
+		cfg.httpsProxy = proxy
+	})
+}
+
+// WithCaCerts enables sentry client tracing.
+func WithCaCerts(caCerts *x509.CertPool) WriterOption {
+	return optionFunc(func(cfg *config) {
+		cfg.caCerts = caCerts
+	})
+}
+
+// WithHTTPClient configures the http client used by the default transport to send events,
+// e.g. with custom dialers, mTLS or timeouts. HTTP transport, proxy and CA certificates options are ignored then.
+func WithHTTPClient(client *http.Client) WriterOption {
+	return optionFunc(func(cfg *config) {
+		cfg.httpClient = client
+	})
+}
+
+// WithHTTPTransport configures the round tripper used by the default transport to send events.
+// Proxy and CA certificates options are ignored then.
+func WithHTTPTransport(transport http.RoundTripper) WriterOption {
+	return optionFunc(func(cfg *config) {
+		cfg.httpTransport = transport
+	})
+}
+
+// WithCompression configures whether the default transport gzips event payloads, disabled by default.
+// Compression trades CPU time for bandwidth, which is worth it for large events like those with
+// long stacktraces or many breadcrumbs, on constrained links. The HTTP client or round tripper
+// configured by WithHTTPClient or WithHTTPTransport is wrapped. A custom WithTransport is not affected.
+func WithCompression(enabled bool) WriterOption {
+	return optionFunc(func(cfg *config) {
+		cfg.compression = enabled
+	})
+}
+
+// WithTags configures log fields that have to be sent as Sentry tags instead of extra.
+func WithTags(fieldNames ...string) WriterOption {
+	return optionFunc(func(cfg *config) {
+		cfg.tagFields = fieldNames
+	})
+}
+
+// WithTagPrefix configures the prefix of log fields sent as Sentry tags with the prefix stripped,
+// e.g. tag_component becomes the component tag, so tag fields are routed by convention.
+func WithTagPrefix(prefix string) WriterOption {
+	return optionFunc(func(cfg *config) {
+		cfg.tagPrefix = prefix
+	})
+}
+
+// WithDefaultTags configures tags attached to every event.
+// Tags from fields configured with WithTags override defaults with the same key.
+func WithDefaultTags(tags map[string]string) WriterOption {
+	return optionFunc(func(cfg *config) {
+		cfg.defaultTags = tags
+	})
+}
+
+// WithDefaultContexts configures contexts attached to every event, e.g. an app context
+// with app_version and build_type. Contexts from fields, see WithContextFromField,
+// replace defaults with the same name.
+func WithDefaultContexts(contexts map[string]sentry.Context) WriterOption {
+	return optionFunc(func(cfg *config) {
+		cfg.defaultContexts = contexts
+	})
+}
+
+// WithStacktraceSkipModules configures module prefixes whose frames are trimmed from the top of stacktraces
+// in addition to zerolog and this package frames. Useful when zerolog is wrapped by a logging facade.
+func WithStacktraceSkipModules(prefixes ...string) WriterOption {
+	return optionFunc(func(cfg *config) {
+		cfg.skipModules = prefixes
+	})
+}
+
+// WithInAppModules configures module prefixes whose stacktrace frames are marked as in-app,
+// other frames are marked as not in-app. Useful for mono-repos where Sentry heuristics get it wrong.
+// Frames of the error stack field have no module and are left as is.
+func WithInAppModules(prefixes ...string) WriterOption {
+	return optionFunc(func(cfg *config) {
+		cfg.inAppModules = prefixes
+	})
+}
+
+// WithMaxStacktraceDepth limits stacktraces captured by the writer to n frames nearest the logging call.
+// Zero means unlimited.
+func WithMaxStacktraceDepth(n int) WriterOption {
+	return optionFunc(func(cfg *config) {
+		cfg.maxStackDepth = n
+	})
+}
+
+// WithMessageOnlyLevels makes events of the levels message-style: errors are kept as extra
+// instead of exceptions with stacktraces, e.g. to reduce noise of expected warnings carrying an error.
+// WithSyntheticException does not apply to them either.
+func WithMessageOnlyLevels(levels ...zerolog.Level) WriterOption {
+	return optionFunc(func(cfg *config) {
+		cfg.messageOnlyLevels = levels
+	})
+}
+
+// WithSyntheticException makes error, fatal and panic events without an error field carry an exception
+// of the level type with the message as the value and a stacktrace, so they are grouped like errors.
+func WithSyntheticException() WriterOption {
+	return optionFunc(func(cfg *config) {
+		cfg.syntheticExc = true
+	})
+}
+
+// WithoutStacktrace disables stacktrace capture for error events.
+func WithoutStacktrace() WriterOption {
+	return optionFunc(func(cfg *config) {
+		cfg.noStacktrace = true
+	})
+}
+
+// WithErrorFieldNames configures additional log fields, e.g. "cause", that have to be sent as exceptions.
+// They are placed before the primary error in the given order, so Sentry renders them as a cause chain.
+func WithErrorFieldNames(names ...string) WriterOption {
+	return optionFunc(func(cfg *config) {
+		cfg.errorFields = names
+	})
+}
+
+// UserFieldNames configures log fields used to populate the event user.
+type UserFieldNames struct {
+	ID        string
+	Email     string
+	Username  string
+	IPAddress string
+}
+
+// WithUserFields configures log fields used to populate the event user.
+// Empty names keep defaults: user_id, user_email, user_username and user_ip.
+func WithUserFields(fields UserFieldNames) WriterOption {
+	return optionFunc(func(cfg *config) {
+		if fields.ID != "" {
+			cfg.userFields.ID = fields.ID
+		}
+		if fields.Email != "" {
+			cfg.userFields.Email = fields.Email
+		}
+		if fields.Username != "" {
+			cfg.userFields.Username = fields.Username
+		}
+		if fields.IPAddress != "" {
+			cfg.userFields.IPAddress = fields.IPAddress
+		}
+	})
+}
+
+// WithUserIDField configures the log field used as the event user ID, e.g. "uid" or "account_id".
+// Default is user_id. Only the first occurrence of the field in a log line is taken.
+func WithUserIDField(name string) WriterOption {
+	return optionFunc(func(cfg *config) {
+		if name != "" {
+			cfg.userFields.ID = name
+		}
+	})
 }
 
-func newStacktrace() *sentry.Stacktrace {
-	const (
-		module       = "github.com/archdx/zerolog-sentry"
-		loggerModule = "github.com/rs/zerolog"
-	)
+// HTTPRequestFields configures log fields used to populate the event request.
+type HTTPRequestFields struct {
+	Method     string
+	URL        string
+	StatusCode string
+	UserAgent  string
+}
 
-	st := sentry.NewStacktrace()
+// WithHTTPRequestFields configures log fields used to populate the event request shown in the Sentry HTTP panel.
+// The status code is stored in the response context. Empty names are not mapped.
+func WithHTTPRequestFields(fields HTTPRequestFields) WriterOption {
+	return optionFunc(func(cfg *config) {
+		cfg.httpFields = &fields
+	})
+}
 
-	threshold := len(st.Frames) - 1
-	// drop current module frames
-	for ; threshold > 0 && st.Frames[threshold].Module == module; threshold-- {
-	}
+// WithContextFromField stores the object field, e.g. written by zerolog Dict, as the named event context
+// instead of extra. Can be used multiple times to map several fields.
+func WithContextFromField(fieldName, contextName string) WriterOption {
+	return optionFunc(func(cfg *config) {
+		if cfg.contextFields == nil {
+			cfg.contextFields = make(map[string]string)
+		}
+		cfg.contextFields[fieldName] = contextName
+	})
+}
 
-outer:
-	// try to drop zerolog module frames after logger call point
-	for i := threshold; i > 0; i-- {
-		if st.Frames[i].Module == loggerModule {
-			for j := i - 1; j >= 0; j-- {
-				if st.Frames[j].Module != loggerModule {
-					threshold = j
-					break outer
-				}
-			}
+// WithErrorTypeField configures the field used as the exception type, e.g. error_type holding "*net.OpError",
+// so Sentry does not group unrelated errors logged with the same message. Defaults to the message when absent.
+func WithErrorTypeField(name string) WriterOption {
+	return optionFunc(func(cfg *config) {
+		cfg.errorTypeField = name
+	})
+}
 
-			break
-		}
-	}
+// WithTransactionField configures the field used as the event transaction, e.g. operation holding "GET /users",
+// so Sentry groups and titles errors by the endpoint or operation. It takes precedence over the caller
+// transaction set by WithCallerFrame.
+func WithTransactionField(name string) WriterOption {
+	return optionFunc(func(cfg *config) {
+		cfg.transactionField = name
+	})
+}
 
-	st.Frames = st.Frames[:threshold+1]
+// WithServerNameField configures the field used as the event server name, e.g. host, for writers
+// processing logs forwarded from many hosts. Events without the field get the server name of the client,
+// see WithServerName.
+func WithServerNameField(name string) WriterOption {
+	return optionFunc(func(cfg *config) {
+		cfg.serverNameField = name
+	})
+}
 
-	return st
+// WithEnvironmentField configures the field used as the event environment, e.g. env, for writers
+// processing logs forwarded from mixed environments. Events without the field get the environment
+// configured by WithEnvironment.
+func WithEnvironmentField(name string) WriterOption {
+	return optionFunc(func(cfg *config) {
+		cfg.environmentField = name
+	})
 }
 
-func bytesToStrUnsafe(data []byte) string {
-	return *(*string)(unsafe.Pointer(&data))
+// WithBreadcrumbsField configures the field holding an array of objects converted to the event breadcrumbs,
+// e.g. recent steps of a request. The message, category, level and timestamp keys of the objects are mapped
+// to the breadcrumb, other keys become its data. Values other than arrays of objects are kept as extra.
+func WithBreadcrumbsField(name string) WriterOption {
+	return optionFunc(func(cfg *config) {
+		cfg.breadcrumbsField = name
+	})
 }
 
-// WriterOption configures sentry events writer.
-type WriterOption interface {
-	apply(*config)
+// WithMaxExtraBytes caps the total size of extra values of an event, so huge log lines do not exceed
+// Sentry payload limits. Oversized strings are truncated with an ellipsis, other values beyond the cap are dropped
+// and the _truncated extra is set. Zero means unlimited.
+func WithMaxExtraBytes(n int) WriterOption {
+	return optionFunc(func(cfg *config) {
+		cfg.maxExtraBytes = n
+	})
 }
 
-type optionFunc func(*config)
+// WithMaxMessageBytes caps the event message, and the fingerprint made up of it, to n bytes,
+// so oversized messages are not dropped by Sentry ingestion. Messages are truncated on a rune boundary
+// with an ellipsis counted in the n bytes. Zero means unlimited.
+func WithMaxMessageBytes(n int) WriterOption {
+	return optionFunc(func(cfg *config) {
+		cfg.maxMessageBytes = n
+	})
+}
 
-func (fn optionFunc) apply(c *config) { fn(c) }
+// WithMaxExtraFields caps the number of extra fields of an event, fields beyond it are dropped
+// and the _truncated extra is set. Zero means unlimited.
+func WithMaxExtraFields(n int) WriterOption {
+	return optionFunc(func(cfg *config) {
+		cfg.maxExtraFields = n
+	})
+}
 
-type EventHintCallback func(event *sentry.Event, hint *sentry.EventHint) *sentry.Event
+// WithoutUserExtra stops duplicating user fields into the event extra.
+func WithoutUserExtra() WriterOption {
+	return optionFunc(func(cfg *config) {
+		cfg.noUserExtra = true
+	})
+}
 
-type config struct {
-	levels           []zerolog.Level
-	sampleRate       float64
-	release          string
-	environment      string
-	serverName       string
-	ignoreErrors     []string
-	debug            bool
-	tracing          bool
-	debugWriter      io.Writer
-	httpProxy        string
-	httpsProxy       string
-	caCerts          *x509.CertPool
-	flushTimeout     time.Duration
-	beforeSend       sentry.EventProcessor
-	tracesSampleRate float64
+// WithBreadcrumbLevels configures zerolog levels that have to be recorded as breadcrumbs instead of events,
+// so they show up as the trail preceding the next captured event.
+// Levels that are also configured by WithLevels are sent as events. Fields other than the message,
+// the level and the timestamp are kept as breadcrumb data, errors included.
+func WithBreadcrumbLevels(levels ...zerolog.Level) WriterOption {
+	return optionFunc(func(cfg *config) {
+		cfg.breadcrumbLevels = levels
+	})
 }
 
-// WithLevels configures zerolog levels that have to be sent to Sentry.
-// Default levels are: error, fatal, panic.
-func WithLevels(levels ...zerolog.Level) WriterOption {
+// WithMaxBreadcrumbs configures the maximum number of breadcrumbs kept by the client.
+func WithMaxBreadcrumbs(max int) WriterOption {
 	return optionFunc(func(cfg *config) {
-		cfg.levels = levels
+		cfg.maxBreadcrumbs = max
 	})
 }
 
-// WithSampleRate configures the sample rate as a percentage of events to be sent in the range of 0.0 to 1.0.
-func WithSampleRate(rate float64) WriterOption {
+// WithTraceContextFields configures log fields holding hex encoded trace and span IDs,
+// e.g. propagated from OpenTelemetry, that are used to link events to the distributed trace.
+// A random span ID is set when the log line carries the trace ID only, see WithParentSpanIDField for the parent span.
+func WithTraceContextFields(traceID, spanID string) WriterOption {
 	return optionFunc(func(cfg *config) {
-		cfg.sampleRate = rate
+		cfg.traceIDField = traceID
+		cfg.spanIDField = spanID
 	})
 }
 
-// WithRelease configures the release to be sent with events.
-func WithRelease(release string) WriterOption {
+// WithParentSpanIDField configures the log field holding the hex encoded parent span ID of the trace context,
+// see WithTraceContextFields.
+func WithParentSpanIDField(name string) WriterOption {
 	return optionFunc(func(cfg *config) {
-		cfg.release = release
+		cfg.parentSpanIDField = name
 	})
 }
 
-// WithEnvironment configures the environment to be sent with events.
-func WithEnvironment(environment string) WriterOption {
+// WithAsync enables capturing events in a background goroutine through a queue of the given size,
+// so logging doesn't wait for the client. Events are dropped when the queue is full, see DroppedEvents.
+// Fatal and panic events are still captured synchronously, after the queued events.
+// Close drains the queue before flushing.
+func WithAsync(queueSize int) WriterOption {
 	return optionFunc(func(cfg *config) {
-		cfg.environment = environment
+		if queueSize > 0 {
+			cfg.asyncQueueSize = queueSize
+		}
 	})
 }
 
-// WithServerName configures the server name field for events. Default value is OS hostname.
-func WithServerName(serverName string) WriterOption {
+// WithCallerFrame enables using zerolog caller field, see zerolog.Context.Caller, as the event location.
+// The caller is appended as the top in-app frame of the exception stacktrace,
+// or set as the event transaction when there is no stacktrace.
+func WithCallerFrame() WriterOption {
 	return optionFunc(func(cfg *config) {
-		cfg.serverName = serverName
+		cfg.callerFrame = true
 	})
 }
 
-// WithIgnoreErrors configures the list of regexp strings that will be used to match against event's message
-// and if applicable, caught errors type and value. If the match is found, then a whole event will be dropped.
-func WithIgnoreErrors(reList []string) WriterOption {
+// WithStrictParsing makes writes fail on log lines that are not valid json or have an unknown level,
+// instead of silently skipping them.
+func WithStrictParsing() WriterOption {
 	return optionFunc(func(cfg *config) {
-		cfg.ignoreErrors = reList
+		cfg.strictParsing = true
 	})
 }
 
-// WithDebug enables sentry client debug logs.
-func WithDebug() WriterOption {
+// WithSafeCopy makes events not to reference the buffer passed to Write.
+// Without it event strings point into the buffer, which zerolog reuses after Write returns,
+// so events retained past the call, e.g. by WithBeforeSend callbacks, may get corrupted.
+func WithSafeCopy() WriterOption {
 	return optionFunc(func(cfg *config) {
-		cfg.debug = true
+		cfg.safeCopy = true
 	})
 }
 
-// WithTracing enables sentry client tracing.
-func WithTracing() WriterOption {
+// WithOnDrop sets a callback which is called every time an event is not sent, e.g. to feed metrics.
+// The callback is called synchronously and may be called concurrently.
+func WithOnDrop(onDrop func(reason DropReason)) WriterOption {
 	return optionFunc(func(cfg *config) {
-		cfg.tracing = true
+		cfg.onDrop = onDrop
 	})
 }
 
-// WithTracingSampleRate sets tracing sample rate.
-func WithTracingSampleRate(tsr float64) WriterOption {
+// WithDeduplication suppresses events identical to one captured within the window.
+// Events are identified by their fingerprint, or by the message and error otherwise.
+// Suppressed events are reported with DropReasonDuplicate.
+func WithDeduplication(window time.Duration) WriterOption {
 	return optionFunc(func(cfg *config) {
-		cfg.tracesSampleRate = tsr
+		cfg.dedupWindow = window
 	})
 }
 
-// WithBeforeSend sets a callback which is called before event is sent.
-func WithBeforeSend(beforeSend sentry.EventProcessor) WriterOption {
+// WithAttachStacktrace configures whether the client attaches stacktraces to messages captured directly by the client.
+func WithAttachStacktrace(attach bool) WriterOption {
 	return optionFunc(func(cfg *config) {
-		cfg.beforeSend = beforeSend
+		cfg.attachStacktrace = attach
 	})
 }
 
-// WithDebugWriter enables sentry client tracing.
-func WithDebugWriter(w io.Writer) WriterOption {
+// WithMaxErrorDepth configures the maximum depth of the error chain unwrapped by the client, by CaptureError
+// and by WriteError looking for a stacktrace, 10 by default.
+func WithMaxErrorDepth(depth int) WriterOption {
 	return optionFunc(func(cfg *config) {
-		cfg.debugWriter = w
+		cfg.maxErrorDepth = depth
 	})
 }
 
-// WithHttpProxy enables sentry client tracing.
-func WithHttpProxy(proxy string) WriterOption {
+// WithClientOptions sets a callback modifying the client options after the other options are applied,
+// e.g. to configure integrations or fields not covered by writer options. Conflicting settings are last-write-wins,
+// can be used multiple times.
+func WithClientOptions(configure func(options *sentry.ClientOptions)) WriterOption {
 	return optionFunc(func(cfg *config) {
-		cfg.httpProxy = proxy
+		cfg.clientOptionFuncs = append(cfg.clientOptionFuncs, configure)
 	})
 }
 
-// WithHttpsProxy enables sentry client tracing.
-func WithHttpsProxy(proxy string) WriterOption {
+// WithTransport configures the transport used by the client to send events.
+func WithTransport(transport sentry.Transport) WriterOption {
 	return optionFunc(func(cfg *config) {
-		cfg.httpsProxy = proxy
+		cfg.transport = transport
 	})
 }
 
-// WithCaCerts enables sentry client tracing.
-func WithCaCerts(caCerts *x509.CertPool) WriterOption {
+// WithSyncTransport makes the client send events with sentry.HTTPSyncTransport, so every capture
+// blocks until the event is delivered. It suits short-lived CLI tools and serverless functions, which may
+// exit before the default transport sends queued events. Long-running services should not use it:
+// every written event costs a request round trip to Sentry on the logging goroutine,
+// unless WithAsync is used too. WithTransport takes precedence.
+func WithSyncTransport() WriterOption {
 	return optionFunc(func(cfg *config) {
-		cfg.caCerts = caCerts
+		cfg.syncTransport = true
 	})
 }
 
@@ -325,36 +2718,467 @@ func New(dsn string, opts ...WriterOption) (*Writer, error) {
 		opt.apply(&cfg)
 	}
 
-	err := sentry.Init(sentry.ClientOptions{
-		Dsn:              dsn,
-		SampleRate:       cfg.sampleRate,
-		Release:          cfg.release,
-		Environment:      cfg.environment,
-		ServerName:       cfg.serverName,
-		IgnoreErrors:     cfg.ignoreErrors,
-		Debug:            cfg.debug,
-		EnableTracing:    cfg.tracing,
-		DebugWriter:      cfg.debugWriter,
-		HTTPProxy:        cfg.httpProxy,
-		HTTPSProxy:       cfg.httpsProxy,
-		CaCerts:          cfg.caCerts,
-		BeforeSend:       cfg.beforeSend,
-		TracesSampleRate: cfg.tracesSampleRate,
-	})
+	cfg.resolve()
+
+	err := sentry.Init(cfg.clientOptions(dsn))
 	if err != nil {
 		return nil, err
 	}
 
+	w := newWriter(sentry.CurrentHub(), cfg)
+	for _, project := range cfg.projects {
+		var client *sentry.Client
+		if client, err = sentry.NewClient(cfg.clientOptions(project.dsn)); err != nil {
+			return nil, err
+		}
+
+		hub := sentry.NewHub(client, sentry.NewScope())
+		w.projectHubs = append(w.projectHubs, hub)
+		if w.levelHubs == nil {
+			w.levelHubs = make(map[zerolog.Level]*sentry.Hub)
+		}
+		for _, level := range project.levels {
+			w.levelHubs[level] = hub
+		}
+	}
+
+	return w, nil
+}
+
+// levelProject is a Sentry project the events of the levels are sent to, see WithProjectForLevels.
+type levelProject struct {
+	dsn    string
+	levels []zerolog.Level
+}
+
+// WithProjectForLevels sends events of the levels to the project of the DSN instead of the writer one,
+// e.g. fatal events to a high priority project. The levels still have to be enabled, e.g. by WithLevels.
+// Can be used multiple times, the last project of a level wins. A client is created per project with
+// the same options, so a transport set by WithTransport is shared, use WithClientOptions checking
+// the DSN to configure transports per project. Routed events do not get the writer hub scope,
+// e.g. set by WithScope or request scoped hubs. Only applies to New.
+func WithProjectForLevels(dsn string, levels ...zerolog.Level) WriterOption {
+	return optionFunc(func(cfg *config) {
+		cfg.projects = append(cfg.projects, levelProject{dsn: dsn, levels: levels})
+	})
+}
+
+// returns the hub of the project the level is sent to by WithProjectForLevels, hub otherwise
+func (w *Writer) levelHub(level zerolog.Level, hub *sentry.Hub) *sentry.Hub {
+	if projectHub, ok := w.levelHubs[level]; ok {
+		return projectHub
+	}
+	return hub
+}
+
+// flushes the writer hub and the project hubs within the timeout
+func (w *Writer) flush(timeout time.Duration) bool {
+	deadline := time.Now().Add(timeout)
+
+	flushed := w.hub.Flush(timeout)
+	for _, hub := range w.projectHubs {
+		flushed = hub.Flush(time.Until(deadline)) && flushed
+	}
+	return flushed
+}
+
+// resolves the options read from the build info and the environment
+func (cfg *config) resolve() {
+	if cfg.serverName == "" {
+		// on failure the server name is left to the client
+		if name, err := hostname(); err == nil {
+			cfg.serverName = name
+		}
+	}
+	if cfg.release == "" && cfg.releaseBuildInfo {
+		cfg.release = buildInfoRevision()
+	}
+	if cfg.environment == "" && cfg.environmentEnv != "" {
+		cfg.environment = os.Getenv(cfg.environmentEnv)
+	}
+	if cfg.k8sContext {
+		cfg.defaultTags = withK8sTags(cfg.defaultTags)
+	}
+}
+
+// returns the client options configured by the writer options
+func (cfg *config) clientOptions(dsn string) sentry.ClientOptions {
+	options := sentry.ClientOptions{
+		Dsn:                   dsn,
+		SampleRate:            cfg.sampleRate,
+		Release:               cfg.release,
+		Dist:                  cfg.dist,
+		Environment:           cfg.environment,
+		ServerName:            cfg.serverName,
+		IgnoreErrors:          cfg.ignoreErrors,
+		Debug:                 cfg.debug,
+		EnableTracing:         cfg.tracing,
+		DebugWriter:           cfg.debugWriter,
+		HTTPProxy:             cfg.httpProxy,
+		HTTPSProxy:            cfg.httpsProxy,
+		CaCerts:               cfg.caCerts,
+		HTTPClient:            cfg.httpClient,
+		HTTPTransport:         cfg.httpTransport,
+		Transport:             cfg.transport,
+		BeforeSend:            cfg.beforeSend,
+		BeforeSendTransaction: cfg.beforeSendTx,
+		TracesSampleRate:      cfg.tracesSampleRate,
+		MaxBreadcrumbs:        cfg.maxBreadcrumbs,
+		AttachStacktrace:      cfg.attachStacktrace,
+		MaxErrorDepth:         cfg.maxErrorDepth,
+	}
+
+	if options.Transport == nil && cfg.syncTransport {
+		// a transport per client, it is configured with the client DSN
+		options.Transport = sentry.NewHTTPSyncTransport()
+	}
+
+	for _, configure := range cfg.clientOptionFuncs {
+		configure(&options)
+	}
+
+	if cfg.compression {
+		compressTransport(&options)
+	}
+
+	return options
+}
+
+// NewWithHub creates writer that sends events through the provided hub.
+// Sentry client is not initialized, so only options unrelated to the client
+// (levels, flush timeout) take effect, except WithEnvironment and WithRelease
+// which are set on the events of the writer, also when resolved by WithEnvironmentFromEnv
+// and WithReleaseFromBuildInfo.
+func NewWithHub(hub *sentry.Hub, opts ...WriterOption) (*Writer, error) {
+	if hub == nil {
+		return nil, errors.New("zlogsentry: hub is nil")
+	}
+
+	cfg := newDefaultConfig()
+	for _, opt := range opts {
+		opt.apply(&cfg)
+	}
+	cfg.resolve()
+
+	w := newWriter(hub, cfg)
+	// the client is not ours, so stamp the events instead
+	w.environment, w.release = cfg.environment, cfg.release
+
+	return w, nil
+}
+
+// NewWithClient creates writer that sends events through the provided client
+// bound to a fresh hub. As with NewWithHub, client related options are ignored.
+func NewWithClient(client *sentry.Client, opts ...WriterOption) (*Writer, error) {
+	if client == nil {
+		return nil, errors.New("zlogsentry: client is nil")
+	}
+
+	return NewWithHub(sentry.NewHub(client, sentry.NewScope()), opts...)
+}
+
+func newWriter(hub *sentry.Hub, cfg config) *Writer {
+	mapping := make(map[zerolog.Level]sentry.Level, len(levelsMapping))
+	for lvl, sentryLvl := range levelsMapping {
+		mapping[lvl] = sentryLvl
+	}
+	for lvl, sentryLvl := range cfg.levelsMapping {
+		mapping[lvl] = sentryLvl
+	}
+
+	var tagFields map[string]struct{}
+	if len(cfg.tagFields) > 0 {
+		tagFields = make(map[string]struct{}, len(cfg.tagFields))
+		for _, name := range cfg.tagFields {
+			tagFields[name] = struct{}{}
+		}
+	}
+
+	var errorFields map[string]int
+	if len(cfg.errorFields) > 0 {
+		errorFields = make(map[string]int, len(cfg.errorFields))
+		for _, name := range cfg.errorFields {
+			if _, ok := errorFields[name]; !ok {
+				errorFields[name] = len(errorFields)
+			}
+		}
+	}
+
+	var defaultTags map[string]string
+	if len(cfg.defaultTags) > 0 {
+		defaultTags = make(map[string]string, len(cfg.defaultTags))
+		for k, v := range cfg.defaultTags {
+			defaultTags[k] = v
+		}
+	}
+
+	var messageOnlyLevels map[zerolog.Level]struct{}
+	if len(cfg.messageOnlyLevels) > 0 {
+		messageOnlyLevels = make(map[zerolog.Level]struct{}, len(cfg.messageOnlyLevels))
+		for _, lvl := range cfg.messageOnlyLevels {
+			messageOnlyLevels[lvl] = struct{}{}
+		}
+	}
+
+	var contextFields map[string]string
+	if len(cfg.contextFields) > 0 {
+		contextFields = make(map[string]string, len(cfg.contextFields))
+		for field, name := range cfg.contextFields {
+			contextFields[field] = name
+		}
+	}
+
+	var fingerprintFields map[string]int
+	if len(cfg.fpFields) > 0 {
+		fingerprintFields = make(map[string]int, len(cfg.fpFields))
+		for _, name := range cfg.fpFields {
+			if _, ok := fingerprintFields[name]; !ok {
+				fingerprintFields[name] = len(fingerprintFields)
+			}
+		}
+	}
+
+	var rateLimits map[zerolog.Level]*tokenBucket
+	for lvl, perSecond := range cfg.rateLimits {
+		if perSecond <= 0 || lvl == zerolog.FatalLevel || lvl == zerolog.PanicLevel {
+			continue
+		}
+		if rateLimits == nil {
+			rateLimits = make(map[zerolog.Level]*tokenBucket, len(cfg.rateLimits))
+		}
+		rateLimits[lvl] = newTokenBucket(perSecond)
+	}
+
+	w := &Writer{
+		hub:           hub,
+		writerState:   &writerState{cfg: cfg},
+		levelsMapping: mapping,
+		tagFields:     tagFields,
+		tagPrefix:     cfg.tagPrefix,
+		errorFields:   errorFields,
+		defaultTags:   defaultTags,
+		levelTag:      cfg.levelTag,
+		flushTimeout:  cfg.flushTimeout,
+
+		fatalFlushTimeout: cfg.flushTimeout,
+
+		userFields:       cfg.userFields,
+		withoutUserExtra: cfg.noUserExtra,
+
+		httpRequestFields: cfg.httpFields,
+		contextFields:     contextFields,
+		defaultContexts:   cfg.defaultContexts,
+		breadcrumbsField:  cfg.breadcrumbsField,
+		errorTypeField:    cfg.errorTypeField,
+		transactionField:  cfg.transactionField,
+		serverNameField:   cfg.serverNameField,
+		environmentField:  cfg.environmentField,
+
+		stacktraceSkipModules: cfg.skipModules,
+		withoutStacktrace:     cfg.noStacktrace,
+		inAppModules:          cfg.inAppModules,
+		maxStacktraceDepth:    cfg.maxStackDepth,
+		maxErrorDepth:         cfg.maxErrorDepth,
+
+		maxExtraBytes:   cfg.maxExtraBytes,
+		maxExtraFields:  cfg.maxExtraFields,
+		maxMessageBytes: cfg.maxMessageBytes,
+
+		syntheticException: cfg.syntheticExc,
+		messageOnlyLevels:  messageOnlyLevels,
+
+		traceIDField:      cfg.traceIDField,
+		spanIDField:       cfg.spanIDField,
+		parentSpanIDField: cfg.parentSpanIDField,
+
+		loggerName:   cfg.loggerName,
+		platform:     cfg.platform,
+		logTimestamp: cfg.logTimestamp,
+
+		unixTimestampPrecision: cfg.unixTsPrecision,
+		fingerprintFields:      fingerprintFields,
+		fingerprintStrategy:    cfg.fpStrategy,
+		fingerprintFunc:        cfg.fpFunc,
+		eventMutator:           cfg.eventMutator,
+		redactFields:           cfg.redactFields,
+		redactPatterns:         cfg.redactPatterns,
+		callerFrame:            cfg.callerFrame,
+		rateLimits:             rateLimits,
+
+		ignoreMessages: cfg.ignoreMessages,
+		dropFunc:       cfg.dropFunc,
+
+		runtimeContext:     cfg.runtimeContext,
+		memStatsSampleRate: cfg.memStatsRate,
+		rawLogLineHint:     cfg.rawHint,
+
+		onDrop:   cfg.onDrop,
+		safeCopy: cfg.safeCopy,
+
+		strictParsing: cfg.strictParsing,
+		defaultLevel:  cfg.defaultLevel,
+		debugWriter:   cfg.debugWriter,
+	}
+
+	w.settings.Store(newLevelSettings(&cfg))
+	w.fieldNames.Store(currentFieldNames())
+
+	if cfg.fatalFlush != nil {
+		w.fatalFlushTimeout = *cfg.fatalFlush
+	}
+
+	if cfg.dedupWindow > 0 {
+		w.dedup = newDedupCache(cfg.dedupWindow)
+	}
+
+	if cfg.asyncQueueSize > 0 {
+		w.async = newAsyncQueue(cfg.asyncQueueSize, func(e asyncEvent) {
+			w.captureSync(e.hub, e.event, e.raw)
+		})
+	}
+
+	return w
+}
+
+// writerState holds the mutable state shared by a writer and its scoped copies.
+type writerState struct {
+	// settings may be replaced by Reconfigure concurrently with writes
+	settings      atomic.Pointer[levelSettings]
+	reconfigureMu sync.Mutex
+	cfg           config
+
+	dropped       atomic.Uint64
+	captureFailed atomic.Bool
+
+	fieldNames atomic.Pointer[fieldNames]
+}
+
+// fieldNames holds the zerolog field names, which are package globals,
+// so changing them while logging does not misclassify fields.
+type fieldNames struct {
+	level      string
+	message    string
+	error      string
+	errorStack string
+	caller     string
+	timestamp  string
+}
+
+func currentFieldNames() *fieldNames {
+	return &fieldNames{
+		level:      zerolog.LevelFieldName,
+		message:    zerolog.MessageFieldName,
+		error:      zerolog.ErrorFieldName,
+		errorStack: zerolog.ErrorStackFieldName,
+		caller:     zerolog.CallerFieldName,
+		timestamp:  zerolog.TimestampFieldName,
+	}
+}
+
+// ReloadFieldNames makes the writer use the current zerolog field names, e.g. zerolog.MessageFieldName,
+// which are read when the writer is created. It is safe to call concurrently with writes.
+func (w *Writer) ReloadFieldNames() {
+	w.fieldNames.Store(currentFieldNames())
+}
+
+// levelSettings holds the level dependent settings which may be changed by Reconfigure.
+type levelSettings struct {
+	levels           map[zerolog.Level]struct{}
+	breadcrumbLevels map[zerolog.Level]struct{}
+	sampleRates      map[zerolog.Level]float64
+}
+
+func newLevelSettings(cfg *config) *levelSettings {
 	levels := make(map[zerolog.Level]struct{}, len(cfg.levels))
 	for _, lvl := range cfg.levels {
 		levels[lvl] = struct{}{}
 	}
 
-	return &Writer{
-		hub:          sentry.CurrentHub(),
-		levels:       levels,
-		flushTimeout: cfg.flushTimeout,
-	}, nil
+	var breadcrumbLevels map[zerolog.Level]struct{}
+	if len(cfg.breadcrumbLevels) > 0 {
+		breadcrumbLevels = make(map[zerolog.Level]struct{}, len(cfg.breadcrumbLevels))
+		for _, lvl := range cfg.breadcrumbLevels {
+			breadcrumbLevels[lvl] = struct{}{}
+		}
+	}
+
+	var sampleRates map[zerolog.Level]float64
+	if len(cfg.levelSampleRates) > 0 {
+		sampleRates = make(map[zerolog.Level]float64, len(cfg.levelSampleRates))
+		for lvl, rate := range cfg.levelSampleRates {
+			switch {
+			case rate < 0:
+				rate = 0
+			case rate > 1:
+				rate = 1
+			}
+			sampleRates[lvl] = rate
+		}
+	}
+
+	return &levelSettings{
+		levels:           levels,
+		breadcrumbLevels: breadcrumbLevels,
+		sampleRates:      sampleRates,
+	}
+}
+
+// Reconfigure applies the options on top of the current configuration at runtime,
+// it is safe to call concurrently with writes. Only the options changing levels,
+// breadcrumb levels and level sample rates take effect, others are ignored.
+func (w *Writer) Reconfigure(opts ...WriterOption) {
+	w.reconfigureMu.Lock()
+	defer w.reconfigureMu.Unlock()
+
+	for _, opt := range opts {
+		opt.apply(&w.cfg)
+	}
+
+	w.settings.Store(newLevelSettings(&w.cfg))
+}
+
+// SetLevels atomically replaces the levels sent to Sentry, taking effect on the next write.
+// It is safe to call concurrently with writes, e.g. to enable debug events during an incident.
+func (w *Writer) SetLevels(levels ...zerolog.Level) {
+	w.Reconfigure(WithLevels(levels...))
+}
+
+// k8sTagsEnv maps default tags to the environment variables of the Kubernetes downward API
+var k8sTagsEnv = map[string]string{
+	"pod_name":      "POD_NAME",
+	"pod_namespace": "POD_NAMESPACE",
+	"node_name":     "NODE_NAME",
+}
+
+// returns a copy of the tags with Kubernetes tags found in the environment
+func withK8sTags(tags map[string]string) map[string]string {
+	merged := make(map[string]string, len(tags)+len(k8sTagsEnv))
+	for tag, env := range k8sTagsEnv {
+		if value := os.Getenv(env); value != "" {
+			merged[tag] = value
+		}
+	}
+	for k, v := range tags {
+		merged[k] = v
+	}
+
+	return merged
+}
+
+// returns the VCS revision stamped by go build, if any
+func buildInfoRevision() string {
+	info, ok := readBuildInfo()
+	if !ok {
+		return ""
+	}
+
+	for _, setting := range info.Settings {
+		if setting.Key == "vcs.revision" {
+			return setting.Value
+		}
+	}
+
+	return ""
 }
 
 func newDefaultConfig() config {
@@ -366,5 +3190,13 @@ func newDefaultConfig() config {
 		},
 		sampleRate:   1.0,
 		flushTimeout: 3 * time.Second,
+		loggerName:   "zerolog",
+		platform:     defaultPlatform,
+		userFields: UserFieldNames{
+			ID:        "user_id",
+			Email:     "user_email",
+			Username:  "user_username",
+			IPAddress: "user_ip",
+		},
 	}
 }
@@ -0,0 +1,66 @@
+package zlogsentry_test
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/getsentry/sentry-go"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	zlogsentry "github.com/egordigitax/zerolog-sentry"
+)
+
+func TestWrite_StacktraceTopFrameIsCaller(t *testing.T) {
+	var frames []sentry.Frame
+	writer, err := zlogsentry.New("", zlogsentry.WithBeforeSend(func(event *sentry.Event, hint *sentry.EventHint) *sentry.Event {
+		require.Len(t, event.Exception, 1)
+		require.NotNil(t, event.Exception[0].Stacktrace)
+		frames = event.Exception[0].Stacktrace.Frames
+		return event
+	}))
+	require.Nil(t, err)
+
+	log := zerolog.New(writer)
+	log.Err(errors.New("dial timeout")).Msg("test message")
+
+	require.NotEmpty(t, frames)
+	top := frames[len(frames)-1]
+	assert.Equal(t, "TestWrite_StacktraceTopFrameIsCaller", top.Function)
+	assert.Equal(t, "writer_external_test.go", filepath.Base(top.AbsPath))
+}
+
+func recurse(depth int, fn func()) {
+	if depth == 0 {
+		fn()
+		return
+	}
+	recurse(depth-1, fn)
+}
+
+func TestWrite_MaxStacktraceDepth(t *testing.T) {
+	var stacks [][]sentry.Frame
+	beforeSend := zlogsentry.WithBeforeSend(func(event *sentry.Event, hint *sentry.EventHint) *sentry.Event {
+		stacks = append(stacks, event.Exception[0].Stacktrace.Frames)
+		return event
+	})
+
+	full, err := zlogsentry.New("", beforeSend)
+	require.Nil(t, err)
+	limited, err := zlogsentry.New("", beforeSend, zlogsentry.WithMaxStacktraceDepth(3))
+	require.Nil(t, err)
+
+	recurse(20, func() {
+		for _, writer := range []*zlogsentry.Writer{full, limited} {
+			log := zerolog.New(writer)
+			log.Err(errors.New("dial timeout")).Msg("test message")
+		}
+	})
+
+	require.Len(t, stacks, 2)
+	require.Greater(t, len(stacks[0]), 20)
+	require.Len(t, stacks[1], 3)
+	assert.Equal(t, stacks[0][len(stacks[0])-3:], stacks[1])
+}
@@ -1,15 +1,31 @@
 package zlogsentry
 
 import (
+	"bytes"
+	"context"
 	"errors"
+	"fmt"
 	"io"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"regexp"
+	"runtime"
+	"runtime/debug"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/getsentry/sentry-go"
+	pkgerrs "github.com/pkg/errors"
 	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/pkgerrors"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/trace"
 )
 
 var logEventJSON = []byte(`{"level":"error","requestId":"bee07485-2485-4f64-99e1-d10165884ca7","error":"dial timeout","time":"2020-06-25T17:19:00+03:00","message":"test message"}`)
@@ -31,6 +47,7 @@ func TestParseLogEvent(t *testing.T) {
 	assert.Equal(t, ts, ev.Timestamp)
 	assert.Equal(t, sentry.LevelError, ev.Level)
 	assert.Equal(t, "zerolog", ev.Logger)
+	assert.Equal(t, "go", ev.Platform)
 	assert.Equal(t, "test message", ev.Message)
 
 	require.Len(t, ev.Exception, 1)
@@ -40,72 +57,1713 @@ func TestParseLogEvent(t *testing.T) {
 	assert.Equal(t, "bee07485-2485-4f64-99e1-d10165884ca7", ev.Extra["requestId"])
 }
 
+func TestParseLogEvent_TypedExtra(t *testing.T) {
+	w, err := New("")
+	require.Nil(t, err)
+
+	ev, ok := w.parseLogEvent([]byte(`{"level":"error","count":42,"ratio":0.5,"ok":true,"nothing":null,"name":"foo","obj":{"a":1},"arr":[1,2]}`))
+	require.True(t, ok)
+
+	assert.Equal(t, int64(42), ev.Extra["count"])
+	assert.Equal(t, 0.5, ev.Extra["ratio"])
+	assert.Equal(t, true, ev.Extra["ok"])
+	assert.Contains(t, ev.Extra, "nothing")
+	assert.Nil(t, ev.Extra["nothing"])
+	assert.Equal(t, "foo", ev.Extra["name"])
+	assert.Equal(t, map[string]interface{}{"a": int64(1)}, ev.Extra["obj"])
+	assert.Equal(t, `[1,2]`, ev.Extra["arr"])
+}
+
+func TestParseLogEvent_Contexts(t *testing.T) {
+	w, err := New("")
+	require.Nil(t, err)
+
+	ev, ok := w.parseLogEvent([]byte(`{"level":"error","http":{"method":"GET","status":500},"db":{"name":"users","pool":{"size":10}}}`))
+	require.True(t, ok)
+
+	assert.Equal(t, map[string]sentry.Context{
+		"http": {"method": "GET", "status": int64(500)},
+	}, ev.Contexts)
+	assert.Equal(t, map[string]interface{}{
+		"db": map[string]interface{}{"name": "users", "pool": map[string]interface{}{"size": int64(10)}},
+	}, ev.Extra)
+}
+
+func TestParseLogEvent_Tags(t *testing.T) {
+	w, err := New("", WithTags("tenant_id", "region"))
+	require.Nil(t, err)
+
+	ev, ok := w.parseLogEvent([]byte(`{"level":"error","tenant_id":"acme","region":"eu","requestId":"42"}`))
+	require.True(t, ok)
+
+	assert.Equal(t, map[string]string{"tenant_id": "acme", "region": "eu"}, ev.Tags)
+	assert.Equal(t, map[string]interface{}{"requestId": "42"}, ev.Extra)
+}
+
+func TestParseLogEvent_DefaultTags(t *testing.T) {
+	w, err := New("",
+		WithDefaultTags(map[string]string{"service": "api", "region": "us"}),
+		WithTags("region"))
+	require.Nil(t, err)
+
+	ev, ok := w.parseLogEvent([]byte(`{"level":"error","region":"eu"}`))
+	require.True(t, ok)
+	assert.Equal(t, map[string]string{"service": "api", "region": "eu"}, ev.Tags)
+
+	ev, ok = w.parseLogEvent([]byte(`{"level":"error"}`))
+	require.True(t, ok)
+	assert.Equal(t, map[string]string{"service": "api", "region": "us"}, ev.Tags)
+}
+
+func TestParseLogEvent_WithoutStacktrace(t *testing.T) {
+	w, err := New("", WithoutStacktrace())
+	require.Nil(t, err)
+
+	ev, ok := w.parseLogEvent(logEventJSON)
+	require.True(t, ok)
+	require.Len(t, ev.Exception, 1)
+	assert.Nil(t, ev.Exception[0].Stacktrace)
+}
+
+func TestParseLogEvent_ErrorStack(t *testing.T) {
+	w, err := New("")
+	require.Nil(t, err)
+
+	ev, ok := w.parseLogEvent([]byte(`{"level":"error","stack":[{"func":"inner","line":"10","source":"inner.go"},{"func":"outer","line":"20","source":"outer.go"}],"error":"dial timeout","message":"test message"}`))
+	require.True(t, ok)
+	require.Len(t, ev.Exception, 1)
+	assert.Equal(t, []sentry.Frame{
+		{Function: "outer", Filename: "outer.go", Lineno: 20},
+		{Function: "inner", Filename: "inner.go", Lineno: 10},
+	}, ev.Exception[0].Stacktrace.Frames)
+	assert.NotContains(t, ev.Extra, "stack")
+
+	// malformed frames fall back to the stacktrace of the logging call
+	ev, ok = w.parseLogEvent([]byte(`{"level":"error","stack":[{"line":"10"}],"error":"dial timeout","message":"test message"}`))
+	require.True(t, ok)
+	require.Len(t, ev.Exception, 1)
+	assert.Equal(t, "TestParseLogEvent_ErrorStack", ev.Exception[0].Stacktrace.Frames[len(ev.Exception[0].Stacktrace.Frames)-1].Function)
+	assert.Equal(t, `[{"line":"10"}]`, ev.Extra["stack"])
+
+	// pkgerrors renders bare function and file names, WithInAppModules has nothing to match them against
+	defer func(marshaler func(err error) interface{}) { zerolog.ErrorStackMarshaler = marshaler }(zerolog.ErrorStackMarshaler)
+	zerolog.ErrorStackMarshaler = pkgerrors.MarshalStack
+
+	var line bytes.Buffer
+	log := zerolog.New(&line)
+	log.Error().Stack().Err(pkgerrs.New("dial timeout")).Msg("test message")
+
+	ev, ok = w.parseLogEvent(line.Bytes())
+	require.True(t, ok)
+	frames := ev.Exception[0].Stacktrace.Frames
+	require.NotEmpty(t, frames)
+	assert.Equal(t, "TestParseLogEvent_ErrorStack", frames[len(frames)-1].Function)
+	assert.Equal(t, "writer_test.go", frames[len(frames)-1].Filename)
+
+	w, err = New("", WithInAppModules(module, "github.com/acme"))
+	require.Nil(t, err)
+
+	ev, ok = w.parseLogEvent(line.Bytes())
+	require.True(t, ok)
+	assert.Equal(t, frames, ev.Exception[0].Stacktrace.Frames)
+
+	// frames without module keep their in-app flag
+	st := &sentry.Stacktrace{Frames: []sentry.Frame{{Function: "inner", Filename: "inner.go", InApp: true}, {Module: "github.com/acme/app"}}}
+	w.markInApp(st)
+	assert.True(t, st.Frames[0].InApp)
+	assert.True(t, st.Frames[1].InApp)
+
+	ev, ok = w.parseLogEvent([]byte(`{"level":"error","stack":"goroutine 1 [running]","error":"dial timeout","message":"test message"}`))
+	require.True(t, ok)
+	require.Len(t, ev.Exception, 1)
+	assert.NotNil(t, ev.Exception[0].Stacktrace)
+	assert.Equal(t, "goroutine 1 [running]", ev.Extra["stack"])
+}
+
+func TestParseLogEvent_ErrorFieldNames(t *testing.T) {
+	w, err := New("", WithErrorFieldNames("cause", "inner_error"))
+	require.Nil(t, err)
+
+	ev, ok := w.parseLogEvent([]byte(`{"level":"error","error":"request failed","inner_error":"connection reset","cause":"dial timeout","message":"test message"}`))
+	require.True(t, ok)
+	require.Len(t, ev.Exception, 3)
+	assert.Equal(t, "cause", ev.Exception[0].Type)
+	assert.Equal(t, "dial timeout", ev.Exception[0].Value)
+	assert.Equal(t, "inner_error", ev.Exception[1].Type)
+	assert.Equal(t, "connection reset", ev.Exception[1].Value)
+	assert.Equal(t, "test message", ev.Exception[2].Type)
+	assert.Equal(t, "request failed", ev.Exception[2].Value)
+	assert.Empty(t, ev.Extra)
+
+	// scratch slices are reused, the previous causes must not leak into the next event
+	ev, ok = w.parseLogEvent([]byte(`{"level":"error","inner_error":"connection reset","message":"test message"}`))
+	require.True(t, ok)
+	require.Len(t, ev.Exception, 1)
+	assert.Equal(t, "inner_error", ev.Exception[0].Type)
+}
+
+func TestParseLogEvent_User(t *testing.T) {
+	const line = `{"level":"error","user_id":"42","user_email":"john@example.com","user_username":"john","ip":"127.0.0.1"}`
+
+	w, err := New("", WithUserFields(UserFieldNames{IPAddress: "ip"}))
+	require.Nil(t, err)
+
+	ev, ok := w.parseLogEvent([]byte(line))
+	require.True(t, ok)
+	assert.Equal(t, sentry.User{ID: "42", Email: "john@example.com", Username: "john", IPAddress: "127.0.0.1"}, ev.User)
+	assert.Len(t, ev.Extra, 4)
+
+	w, err = New("", WithUserFields(UserFieldNames{IPAddress: "ip"}), WithoutUserExtra())
+	require.Nil(t, err)
+
+	ev, ok = w.parseLogEvent([]byte(line))
+	require.True(t, ok)
+	assert.Equal(t, sentry.User{ID: "42", Email: "john@example.com", Username: "john", IPAddress: "127.0.0.1"}, ev.User)
+	assert.Empty(t, ev.Extra)
+}
+
+func TestParseLogEvent_UserIDField(t *testing.T) {
+	w, err := New("", WithUserIDField("uid"))
+	require.Nil(t, err)
+
+	ev, ok := w.parseLogEvent([]byte(`{"level":"error","uid":"42","user_id":"13","uid":"7"}`))
+	require.True(t, ok)
+	assert.Equal(t, "42", ev.User.ID)
+	assert.Equal(t, "13", ev.Extra["user_id"])
+}
+
+func TestParseLogEvent_TraceContext(t *testing.T) {
+	w, err := New("", WithTraceContextFields("trace_id", "span_id"))
+	require.Nil(t, err)
+
+	ev, ok := w.parseLogEvent([]byte(`{"level":"error","trace_id":"4bf92f3577b34da6a3ce929d0e0e4736","span_id":"00f067aa0ba902b7"}`))
+	require.True(t, ok)
+	require.Contains(t, ev.Contexts, "trace")
+
+	trace := ev.Contexts["trace"]
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", trace["trace_id"].(sentry.TraceID).String())
+	assert.Equal(t, "00f067aa0ba902b7", trace["span_id"].(sentry.SpanID).String())
+	assert.Empty(t, ev.Extra)
+
+	ev, ok = w.parseLogEvent([]byte(`{"level":"error","trace_id":"invalid","span_id":"00f067aa0ba902b7"}`))
+	require.True(t, ok)
+	assert.Empty(t, ev.Contexts)
+	assert.Equal(t, "invalid", ev.Extra["trace_id"])
+	assert.Equal(t, "00f067aa0ba902b7", ev.Extra["span_id"])
+
+	w, err = New("", WithTraceContextFields("trace_id", "span_id"), WithParentSpanIDField("parent_span_id"))
+	require.Nil(t, err)
+
+	ev, ok = w.parseLogEvent([]byte(`{"level":"error","trace_id":"4bf92f3577b34da6a3ce929d0e0e4736","span_id":"00f067aa0ba902b7","parent_span_id":"b7ad6b7169203331"}`))
+	require.True(t, ok)
+	trace = ev.Contexts["trace"]
+	assert.Equal(t, "00f067aa0ba902b7", trace["span_id"].(sentry.SpanID).String())
+	assert.Equal(t, "b7ad6b7169203331", trace["parent_span_id"].(sentry.SpanID).String())
+	assert.Empty(t, ev.Extra)
+
+	// the span id is generated when missing
+	ev, ok = w.parseLogEvent([]byte(`{"level":"error","trace_id":"4bf92f3577b34da6a3ce929d0e0e4736"}`))
+	require.True(t, ok)
+	trace = ev.Contexts["trace"]
+	assert.NotEqual(t, sentry.SpanID{}, trace["span_id"])
+	assert.NotContains(t, trace, "parent_span_id")
+
+	ev, ok = w.parseLogEvent([]byte(`{"level":"error","parent_span_id":"b7ad6b7169203331"}`))
+	require.True(t, ok)
+	assert.Empty(t, ev.Contexts)
+	assert.Equal(t, "b7ad6b7169203331", ev.Extra["parent_span_id"])
+}
+
+func TestParseLogEvent_CallerFrame(t *testing.T) {
+	w, err := New("", WithCallerFrame())
+	require.Nil(t, err)
+
+	ev, ok := w.parseLogEvent([]byte(`{"level":"error","caller":"/app/main.go:42","error":"dial timeout","message":"test message"}`))
+	require.True(t, ok)
+	require.Len(t, ev.Exception, 1)
+	frames := ev.Exception[0].Stacktrace.Frames
+	assert.Equal(t, sentry.Frame{Filename: "main.go", AbsPath: "/app/main.go", Lineno: 42, InApp: true}, frames[len(frames)-1])
+	assert.NotContains(t, ev.Extra, "caller")
+
+	ev, ok = w.parseLogEvent([]byte(`{"level":"error","caller":"/app/main.go:42","message":"test message"}`))
+	require.True(t, ok)
+	assert.Equal(t, "/app/main.go:42", ev.Transaction)
+
+	w, err = New("")
+	require.Nil(t, err)
+
+	ev, ok = w.parseLogEvent([]byte(`{"level":"error","caller":"/app/main.go:42","message":"test message"}`))
+	require.True(t, ok)
+	assert.Empty(t, ev.Transaction)
+	assert.Equal(t, "/app/main.go:42", ev.Extra["caller"])
+}
+
+func TestParseLogEvent_LoggerName(t *testing.T) {
+	w, err := New("", WithLoggerName("billing"))
+	require.Nil(t, err)
+
+	ev, ok := w.parseLogEvent(logEventJSON)
+	require.True(t, ok)
+	assert.Equal(t, "billing", ev.Logger)
+}
+
+func TestParseLogEvent_LogTimestamp(t *testing.T) {
+	ts := time.Now()
+	now = func() time.Time { return ts }
+	defer func() { now = time.Now }()
+
+	w, err := New("", WithLogTimestamp(true))
+	require.Nil(t, err)
+
+	ev, ok := w.parseLogEvent(logEventJSON)
+	require.True(t, ok)
+	assert.Equal(t, "2020-06-25T17:19:00+03:00", ev.Timestamp.Format(time.RFC3339))
+
+	ev, ok = w.parseLogEvent([]byte(`{"level":"error","time":"yesterday"}`))
+	require.True(t, ok)
+	assert.Equal(t, ts, ev.Timestamp)
+
+	w, err = New("")
+	require.Nil(t, err)
+
+	ev, ok = w.parseLogEvent(logEventJSON)
+	require.True(t, ok)
+	assert.Equal(t, ts, ev.Timestamp)
+}
+
+func TestParseLogEvent_UnixTimestamp(t *testing.T) {
+	ts := time.Date(2020, 6, 25, 17, 19, 0, 123456789, time.UTC)
+
+	timeFieldFormat, timestampFunc := zerolog.TimeFieldFormat, zerolog.TimestampFunc
+	defer func() { zerolog.TimeFieldFormat, zerolog.TimestampFunc = timeFieldFormat, timestampFunc }()
+	zerolog.TimestampFunc = func() time.Time { return ts }
+
+	tests := []struct {
+		format    string
+		precision time.Duration
+		expected  time.Time
+	}{
+		{format: zerolog.TimeFormatUnix, expected: ts.Truncate(time.Second)},
+		{format: zerolog.TimeFormatUnixMs, expected: ts.Truncate(time.Millisecond)},
+		{format: zerolog.TimeFormatUnixMicro, expected: ts.Truncate(time.Microsecond)},
+		// explicit precision overrides the one implied by the format
+		{format: zerolog.TimeFormatUnix, precision: time.Millisecond, expected: time.UnixMilli(ts.Unix())},
+	}
+
+	for _, tc := range tests {
+		zerolog.TimeFieldFormat = tc.format
+
+		var timestamp time.Time
+		writer, err := New("",
+			WithLogTimestamp(true),
+			WithUnixTimestampPrecision(tc.precision),
+			WithBeforeSend(func(event *sentry.Event, hint *sentry.EventHint) *sentry.Event {
+				timestamp = event.Timestamp
+				return event
+			}))
+		require.Nil(t, err)
+
+		log := zerolog.New(writer).With().Timestamp().Logger()
+		log.Error().Msg("test message")
+
+		assert.True(t, tc.expected.Equal(timestamp), "format %q: expected %v, got %v", tc.format, tc.expected, timestamp)
+	}
+}
+
+func TestParseLogEvent_FingerprintFields(t *testing.T) {
+	w, err := New("", WithFingerprintFields("route", "error_code"))
+	require.Nil(t, err)
+
+	ev, ok := w.parseLogEvent([]byte(`{"level":"error","error_code":"E42","route":"/users","error":"dial timeout","message":"test message"}`))
+	require.True(t, ok)
+	assert.Equal(t, []string{"/users", "E42"}, ev.Fingerprint)
+
+	ev, ok = w.parseLogEvent([]byte(`{"level":"error","route":"/users","fingerprint":"custom"}`))
+	require.True(t, ok)
+	assert.Equal(t, []string{"custom"}, ev.Fingerprint)
+
+	ev, ok = w.parseLogEvent([]byte(`{"level":"error","error":"dial timeout","message":"test message"}`))
+	require.True(t, ok)
+	assert.Equal(t, []string{"dial timeout", "test message"}, ev.Fingerprint)
+}
+
+func TestParseLogEvent_WithoutMessageFingerprint(t *testing.T) {
+	w, err := New("", WithoutMessageFingerprint())
+	require.Nil(t, err)
+
+	ev, ok := w.parseLogEvent([]byte(`{"level":"error","message":"user 42 not found"}`))
+	require.True(t, ok)
+	assert.Equal(t, "user 42 not found", ev.Message)
+	assert.Empty(t, ev.Fingerprint)
+
+	ev, ok = w.parseLogEvent([]byte(`{"level":"error","error":"dial timeout","message":"user 42 not found"}`))
+	require.True(t, ok)
+	assert.Equal(t, []string{"dial timeout"}, ev.Fingerprint)
+
+	ev, ok = w.parseLogEvent([]byte(`{"level":"error","fingerprint":"custom","message":"user 42 not found"}`))
+	require.True(t, ok)
+	assert.Equal(t, []string{"custom"}, ev.Fingerprint)
+}
+
+func TestParseLogEvent_FingerprintStrategy(t *testing.T) {
+	const line = `{"level":"error","error":"dial timeout","message":"user 42 not found"}`
+
+	w, err := New("", WithFingerprintStrategy(FingerprintFromStacktrace))
+	require.Nil(t, err)
+
+	ev, ok := w.parseLogEvent([]byte(line))
+	require.True(t, ok)
+	assert.Empty(t, ev.Fingerprint)
+
+	ev, ok = w.parseLogEvent([]byte(`{"level":"error","fingerprint":"custom","message":"user 42 not found"}`))
+	require.True(t, ok)
+	assert.Equal(t, []string{"custom"}, ev.Fingerprint)
+
+	w, err = New("", WithFingerprintFunc(func(event *sentry.Event) []string {
+		return append([]string{event.Exception[0].Type}, event.Fingerprint...)
+	}))
+	require.Nil(t, err)
+
+	ev, ok = w.parseLogEvent([]byte(line))
+	require.True(t, ok)
+	assert.Equal(t, []string{"user 42 not found", "dial timeout", "user 42 not found"}, ev.Fingerprint)
+
+	ev, ok = w.parseLogEvent([]byte(`{"level":"error","fingerprint":"custom","error":"dial timeout"}`))
+	require.True(t, ok)
+	assert.Equal(t, []string{"custom"}, ev.Fingerprint)
+}
+
+func TestParseLogEvent_MaxMessageBytes(t *testing.T) {
+	w, err := New("", WithMaxMessageBytes(8))
+	require.Nil(t, err)
+
+	// "é" is 2 bytes, the cut at 8 bytes less the 3 bytes marker would split it
+	ev, ok := w.parseLogEvent([]byte(`{"level":"error","error":"dial timeout","message":"coupé failed"}`))
+	require.True(t, ok)
+	assert.Equal(t, "coup…", ev.Message)
+	assert.LessOrEqual(t, len(ev.Message), 8)
+	assert.Equal(t, []string{"dial timeout", "coup…"}, ev.Fingerprint)
+	assert.Equal(t, "coup…", ev.Exception[0].Type)
+
+	ev, ok = w.parseLogEvent([]byte(`{"level":"error","message":"shortest"}`))
+	require.True(t, ok)
+	assert.Equal(t, "shortest", ev.Message)
+
+	// the marker does not fit
+	w, err = New("", WithMaxMessageBytes(2))
+	require.Nil(t, err)
+
+	ev, ok = w.parseLogEvent([]byte(`{"level":"error","message":"coupé failed"}`))
+	require.True(t, ok)
+	assert.Equal(t, "co", ev.Message)
+}
+
+func TestParseLogEvent_Fingerprint(t *testing.T) {
+	w, err := New("")
+	require.Nil(t, err)
+
+	ev, ok := w.parseLogEvent([]byte(`{"level":"error","fingerprint":"custom","message":"test message"}`))
+	require.True(t, ok)
+	assert.Equal(t, []string{"custom"}, ev.Fingerprint)
+
+	ev, ok = w.parseLogEvent([]byte(`{"level":"error","fingerprint":["{{ default }}","custom"],"message":"test message"}`))
+	require.True(t, ok)
+	assert.Equal(t, []string{"{{ default }}", "custom"}, ev.Fingerprint)
+}
+
+func TestParseLogEvent_EventMutator(t *testing.T) {
+	w, err := New("", WithEventMutator(func(event *sentry.Event, raw []byte) {
+		assert.Equal(t, logEventJSON, raw)
+		event.Transaction = event.Extra["requestId"].(string)
+		delete(event.Extra, "requestId")
+	}))
+	require.Nil(t, err)
+
+	ev, ok := w.parseLogEvent(logEventJSON)
+	require.True(t, ok)
+	assert.Equal(t, "bee07485-2485-4f64-99e1-d10165884ca7", ev.Transaction)
+	assert.Empty(t, ev.Extra)
+}
+
 func TestParseLogLevel(t *testing.T) {
 	w, err := New("")
 	require.Nil(t, err)
 
-	level, err := w.parseLogLevel(logEventJSON)
+	level, err := w.parseLogLevel(logEventJSON)
+	require.Nil(t, err)
+	assert.Equal(t, zerolog.ErrorLevel, level)
+}
+
+func TestWithFlushTimeout(t *testing.T) {
+	w, err := New("", WithFlushTimeout(time.Second))
+	require.Nil(t, err)
+	assert.Equal(t, time.Second, w.flushTimeout)
+
+	w, err = New("", WithFlushTimeout(-time.Second))
+	require.Nil(t, err)
+	assert.Equal(t, 3*time.Second, w.flushTimeout)
+}
+
+func TestWithFatalFlushTimeout(t *testing.T) {
+	w, err := New("", WithFlushTimeout(time.Second))
+	require.Nil(t, err)
+	assert.Equal(t, time.Second, w.fatalFlushTimeout)
+
+	transport := &testTransport{}
+	w, err = New("", WithTransport(transport), WithFatalFlushTimeout(100*time.Millisecond), WithFatalFlushTimeout(-time.Second))
+	require.Nil(t, err)
+
+	_, err = w.WriteLevel(zerolog.FatalLevel, logEventJSON)
+	require.Nil(t, err)
+	assert.Equal(t, 100*time.Millisecond, transport.timeout)
+
+	require.Nil(t, w.Close())
+	assert.Equal(t, 3*time.Second, transport.timeout)
+}
+
+func TestNewWithHub(t *testing.T) {
+	_, err := NewWithHub(nil)
+	require.NotNil(t, err)
+
+	beforeSendCalled := false
+	client, err := sentry.NewClient(sentry.ClientOptions{
+		BeforeSend: func(event *sentry.Event, hint *sentry.EventHint) *sentry.Event {
+			assert.Equal(t, "test message", event.Message)
+			beforeSendCalled = true
+			return event
+		},
+	})
+	require.Nil(t, err)
+
+	hub := sentry.NewHub(client, sentry.NewScope())
+	writer, err := NewWithHub(hub, WithFlushTimeout(time.Second))
+	require.Nil(t, err)
+	assert.Same(t, hub, writer.hub)
+	assert.Equal(t, time.Second, writer.flushTimeout)
+
+	log := zerolog.New(writer)
+	log.Err(errors.New("dial timeout")).Msg("test message")
+
+	require.True(t, beforeSendCalled)
+}
+
+func TestWithProjectForLevels(t *testing.T) {
+	const fatalDSN = "http://public@localhost/2"
+
+	primary, fatal := &testTransport{}, &testTransport{}
+	writer, err := New("http://public@localhost/1",
+		WithLevels(zerolog.ErrorLevel, zerolog.FatalLevel),
+		WithProjectForLevels(fatalDSN, zerolog.FatalLevel),
+		WithClientOptions(func(options *sentry.ClientOptions) {
+			options.Transport = primary
+			if options.Dsn == fatalDSN {
+				options.Transport = fatal
+			}
+		}))
+	require.Nil(t, err)
+
+	_, err = writer.WriteLevel(zerolog.ErrorLevel, logEventJSON)
+	require.Nil(t, err)
+	_, err = writer.WriteLevel(zerolog.FatalLevel, logEventJSON)
+	require.Nil(t, err)
+	writer.WriteError(errors.New("dial timeout"), zerolog.FatalLevel)
+
+	require.Len(t, primary.events, 1)
+	assert.Equal(t, sentry.LevelError, primary.events[0].Level)
+	require.Len(t, fatal.events, 2)
+	assert.Equal(t, sentry.LevelFatal, fatal.events[0].Level)
+	assert.Equal(t, sentry.LevelFatal, fatal.events[1].Level)
+
+	primary.flushes, fatal.flushes = 0, 0
+	require.Nil(t, writer.Close())
+	assert.Equal(t, 1, primary.flushes)
+	assert.Equal(t, 1, fatal.flushes)
+}
+
+func TestNewWithHub_EnvironmentRelease(t *testing.T) {
+	transport := &testTransport{}
+	client, err := sentry.NewClient(sentry.ClientOptions{Transport: transport, Environment: "staging"})
+	require.Nil(t, err)
+
+	writer, err := NewWithClient(client, WithEnvironment("production"), WithRelease("1.0.0"))
+	require.Nil(t, err)
+
+	_, err = writer.Write(logEventJSON)
+	require.Nil(t, err)
+
+	writer, err = NewWithClient(client)
+	require.Nil(t, err)
+
+	_, err = writer.Write(logEventJSON)
+	require.Nil(t, err)
+
+	require.Len(t, transport.events, 2)
+	assert.Equal(t, "production", transport.events[0].Environment)
+	assert.Equal(t, "1.0.0", transport.events[0].Release)
+	assert.Equal(t, "staging", transport.events[1].Environment)
+
+	defer func() { readBuildInfo = debug.ReadBuildInfo }()
+	readBuildInfo = func() (*debug.BuildInfo, bool) {
+		return &debug.BuildInfo{Settings: []debug.BuildSetting{{Key: "vcs.revision", Value: "4bf92f3"}}}, true
+	}
+	t.Setenv("APP_ENV", "qa")
+	t.Setenv("POD_NAME", "api-7d9f")
+
+	client, err = sentry.NewClient(sentry.ClientOptions{Transport: transport})
+	require.Nil(t, err)
+
+	writer, err = NewWithHub(sentry.NewHub(client, sentry.NewScope()),
+		WithReleaseFromBuildInfo(), WithEnvironmentFromEnv("APP_ENV"), WithK8sContext())
+	require.Nil(t, err)
+
+	_, err = writer.Write(logEventJSON)
+	require.Nil(t, err)
+
+	require.Len(t, transport.events, 3)
+	assert.Equal(t, "qa", transport.events[2].Environment)
+	assert.Equal(t, "4bf92f3", transport.events[2].Release)
+	assert.Equal(t, "api-7d9f", transport.events[2].Tags["pod_name"])
+}
+
+func TestNewWithClient(t *testing.T) {
+	_, err := NewWithClient(nil)
+	require.NotNil(t, err)
+
+	client, err := sentry.NewClient(sentry.ClientOptions{})
+	require.Nil(t, err)
+
+	writer, err := NewWithClient(client)
+	require.Nil(t, err)
+	assert.Same(t, client, writer.hub.Client())
+	assert.NotSame(t, sentry.CurrentHub(), writer.hub)
+}
+
+func TestNew_ReleaseAndEnvironmentFromBuild(t *testing.T) {
+	defer func() { readBuildInfo = debug.ReadBuildInfo }()
+	readBuildInfo = func() (*debug.BuildInfo, bool) {
+		return &debug.BuildInfo{Settings: []debug.BuildSetting{{Key: "vcs.revision", Value: "4bf92f3"}}}, true
+	}
+	t.Setenv("APP_ENV", "staging")
+
+	_, err := New("", WithReleaseFromBuildInfo(), WithEnvironmentFromEnv("APP_ENV"))
+	require.Nil(t, err)
+	assert.Equal(t, "4bf92f3", sentry.CurrentHub().Client().Options().Release)
+	assert.Equal(t, "staging", sentry.CurrentHub().Client().Options().Environment)
+
+	_, err = New("", WithReleaseFromBuildInfo(), WithRelease("1.0.0"), WithEnvironmentFromEnv("APP_ENV"), WithEnvironment("dev"))
+	require.Nil(t, err)
+	assert.Equal(t, "1.0.0", sentry.CurrentHub().Client().Options().Release)
+	assert.Equal(t, "dev", sentry.CurrentHub().Client().Options().Environment)
+}
+
+func TestNew_ServerNameFromHostname(t *testing.T) {
+	defer func() { hostname = os.Hostname }()
+	hostname = func() (string, error) { return "api-1", nil }
+
+	_, err := New("")
+	require.Nil(t, err)
+	assert.Equal(t, "api-1", sentry.CurrentHub().Client().Options().ServerName)
+
+	_, err = New("", WithServerName("worker-1"))
+	require.Nil(t, err)
+	assert.Equal(t, "worker-1", sentry.CurrentHub().Client().Options().ServerName)
+
+	hostname = func() (string, error) { return "", errors.New("no hostname") }
+	cfg := newDefaultConfig()
+	cfg.resolve()
+	assert.Empty(t, cfg.serverName)
+}
+
+func TestNew_ClientOptions(t *testing.T) {
+	_, err := New("",
+		WithRelease("1.0.0"),
+		WithEnvironment("dev"),
+		WithClientOptions(func(options *sentry.ClientOptions) {
+			assert.Equal(t, "1.0.0", options.Release)
+			options.Release = "2.0.0"
+			options.MaxSpans = 10
+		}),
+		WithClientOptions(func(options *sentry.ClientOptions) {
+			options.Release += "-rc1"
+		}))
+	require.Nil(t, err)
+
+	options := sentry.CurrentHub().Client().Options()
+	assert.Equal(t, "2.0.0-rc1", options.Release)
+	assert.Equal(t, "dev", options.Environment)
+	assert.Equal(t, 10, options.MaxSpans)
+}
+
+func TestNew_HTTPClient(t *testing.T) {
+	client := &http.Client{Timeout: time.Second}
+	roundTripper := &http.Transport{}
+
+	_, err := New("", WithHTTPClient(client), WithHTTPTransport(roundTripper))
+	require.Nil(t, err)
+	assert.Same(t, client, sentry.CurrentHub().Client().Options().HTTPClient)
+	assert.Same(t, roundTripper, sentry.CurrentHub().Client().Options().HTTPTransport)
+}
+
+func TestNew_SyncTransport(t *testing.T) {
+	var received atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received.Add(1)
+	}))
+	defer server.Close()
+
+	dsn := strings.Replace(server.URL, "http://", "http://public@", 1) + "/1"
+	writer, err := New(dsn, WithSyncTransport())
+	require.Nil(t, err)
+	assert.IsType(t, &sentry.HTTPSyncTransport{}, writer.Hub().Client().Transport)
+
+	_, err = writer.WriteLevel(zerolog.ErrorLevel, logEventJSON)
+	require.Nil(t, err)
+	// delivered before the write returns, without flushing
+	assert.Equal(t, int32(1), received.Load())
+
+	transport := &testTransport{}
+	writer, err = New("", WithSyncTransport(), WithTransport(transport))
+	require.Nil(t, err)
+	assert.Same(t, transport, writer.Hub().Client().Transport)
+}
+
+func TestNew_K8sContext(t *testing.T) {
+	t.Setenv("POD_NAME", "api-7d9f")
+	t.Setenv("POD_NAMESPACE", "prod")
+	t.Setenv("NODE_NAME", "")
+
+	writer, err := New("", WithK8sContext(), WithDefaultTags(map[string]string{"pod_namespace": "staging"}))
+	require.Nil(t, err)
+	assert.Equal(t, map[string]string{"pod_name": "api-7d9f", "pod_namespace": "staging"}, writer.defaultTags)
+}
+
+func TestParseLogEvent_HTTPRequestFields(t *testing.T) {
+	w, err := New("", WithHTTPRequestFields(HTTPRequestFields{
+		Method:     "method",
+		URL:        "url",
+		StatusCode: "status_code",
+		UserAgent:  "user_agent",
+	}))
+	require.Nil(t, err)
+
+	event, ok := w.parseLogEvent([]byte(`{"level":"error","method":"POST","url":"https://api.example.com/orders?id=42","status_code":502,"user_agent":"curl/8.0","duration":1.5,"error":"bad gateway","message":"upstream failed"}`))
+	require.True(t, ok)
+	assert.Equal(t, &sentry.Request{
+		Method:      "POST",
+		URL:         "https://api.example.com/orders",
+		QueryString: "id=42",
+		Headers:     map[string]string{"User-Agent": "curl/8.0"},
+	}, event.Request)
+	assert.Equal(t, sentry.Context{"status_code": int64(502)}, event.Contexts["response"])
+	assert.Equal(t, map[string]interface{}{"duration": 1.5}, event.Extra)
+}
+
+func TestParseLogEvent_ContextFromField(t *testing.T) {
+	w, err := New("", WithContextFromField("db", "database"), WithContextFromField("job", "job"))
+	require.Nil(t, err)
+
+	event, ok := w.parseLogEvent([]byte(`{"level":"error","db":{"system":"postgres","rows":3},"job":"not an object","message":"query failed"}`))
+	require.True(t, ok)
+	assert.Equal(t, map[string]sentry.Context{
+		"database": {"system": "postgres", "rows": int64(3)},
+	}, event.Contexts)
+	assert.Equal(t, map[string]interface{}{"job": "not an object"}, event.Extra)
+}
+
+func TestParseLogEvent_DefaultContexts(t *testing.T) {
+	defaults := map[string]sentry.Context{
+		"app":      {"app_version": "1.0.0", "build_type": "release"},
+		"database": {"system": "mysql"},
+	}
+	w, err := New("", WithDefaultContexts(defaults), WithContextFromField("db", "database"))
+	require.Nil(t, err)
+
+	event, ok := w.parseLogEvent([]byte(`{"level":"error","db":{"system":"postgres"},"message":"query failed"}`))
+	require.True(t, ok)
+	assert.Equal(t, map[string]sentry.Context{
+		"app":      {"app_version": "1.0.0", "build_type": "release"},
+		"database": {"system": "postgres"},
+	}, event.Contexts)
+
+	// events get copies of the defaults
+	event.Contexts["app"]["app_version"] = "2.0.0"
+	assert.Equal(t, "1.0.0", defaults["app"]["app_version"])
+
+	w, err = New("")
+	require.Nil(t, err)
+
+	event, ok = w.parseLogEvent(logEventJSON)
+	require.True(t, ok)
+	assert.Nil(t, event.Contexts)
+}
+
+func TestParseLogEvent_BreadcrumbsField(t *testing.T) {
+	w, err := New("", WithBreadcrumbsField("events"))
+	require.Nil(t, err)
+
+	event, ok := w.parseLogEvent([]byte(`{"level":"error","events":[{"message":"cache miss","category":"cache","level":"warn","timestamp":"2020-06-25T17:19:00+03:00","key":"user:1"},{"message":"query","level":"info"}],"message":"test message"}`))
+	require.True(t, ok)
+	assert.Equal(t, []*sentry.Breadcrumb{
+		{
+			Message:   "cache miss",
+			Category:  "cache",
+			Level:     sentry.LevelWarning,
+			Timestamp: time.Date(2020, 6, 25, 17, 19, 0, 0, time.FixedZone("", 3*60*60)),
+			Data:      map[string]interface{}{"key": "user:1"},
+		},
+		{Message: "query", Level: sentry.LevelInfo},
+	}, event.Breadcrumbs)
+	assert.Empty(t, event.Extra)
+
+	event, ok = w.parseLogEvent([]byte(`{"level":"error","events":["started"],"message":"test message"}`))
+	require.True(t, ok)
+	assert.Empty(t, event.Breadcrumbs)
+	assert.Equal(t, map[string]interface{}{"events": `["started"]`}, event.Extra)
+}
+
+func TestNewStacktrace_MaxDepth(t *testing.T) {
+	w, err := New("", WithMaxStacktraceDepth(1))
+	require.Nil(t, err)
+	assert.Len(t, w.newStacktrace().Frames, 1)
+}
+
+func TestMarkInApp(t *testing.T) {
+	w, err := New("", WithInAppModules("github.com/acme/api", "github.com/acme/pkg"))
+	require.Nil(t, err)
+
+	st := &sentry.Stacktrace{Frames: []sentry.Frame{
+		{Module: "runtime", InApp: true},
+		{Module: "net/http"},
+		{Module: "github.com/acme/api/handlers"},
+		{Module: "github.com/acme/pkg/db"},
+		{Module: "github.com/other/lib"},
+	}}
+	w.markInApp(st)
+
+	inApp := make([]bool, 0, len(st.Frames))
+	for _, frame := range st.Frames {
+		inApp = append(inApp, frame.InApp)
+	}
+	assert.Equal(t, []bool{false, false, true, true, false}, inApp)
+}
+
+func TestParseLogEvent_MaxExtra(t *testing.T) {
+	w, err := New("", WithMaxExtraBytes(10))
+	require.Nil(t, err)
+
+	event, ok := w.parseLogEvent([]byte(`{"level":"error","a":"abcd","b":"привет","c":1,"message":"test message"}`))
+	require.True(t, ok)
+	// 6 bytes are left for b, "п" and the marker fit, so c fits in the last byte
+	assert.Equal(t, map[string]interface{}{"a": "abcd", "b": "п…", "c": int64(1), "_truncated": true}, event.Extra)
+
+	w, err = New("", WithMaxExtraFields(2))
+	require.Nil(t, err)
+
+	event, ok = w.parseLogEvent([]byte(`{"level":"error","a":"abcd","b":2,"c":3,"message":"test message"}`))
+	require.True(t, ok)
+	assert.Equal(t, map[string]interface{}{"a": "abcd", "b": int64(2), "_truncated": true}, event.Extra)
+
+	event, ok = w.parseLogEvent(logEventJSON)
+	require.True(t, ok)
+	assert.NotContains(t, event.Extra, "_truncated")
+}
+
+func TestParseLogEvent_TagPrefix(t *testing.T) {
+	w, err := New("", WithTagPrefix("tag_"))
+	require.Nil(t, err)
+
+	event, ok := w.parseLogEvent([]byte(`{"level":"error","tag_component":"billing","tag_":"empty","component":"api","message":"test message"}`))
+	require.True(t, ok)
+	assert.Equal(t, map[string]string{"component": "billing"}, event.Tags)
+	assert.Equal(t, map[string]interface{}{"tag_": "empty", "component": "api"}, event.Extra)
+}
+
+func TestParseLogEvent_FieldNamesSnapshot(t *testing.T) {
+	defer func() {
+		zerolog.ErrorFieldName = "error"
+		zerolog.LevelFieldName = "level"
+	}()
+
+	w, err := New("")
+	require.Nil(t, err)
+
+	zerolog.ErrorFieldName = "err"
+	zerolog.LevelFieldName = "lvl"
+
+	line := []byte(`{"level":"error","err":"wrapped","error":"dial timeout","message":"test message"}`)
+	level, err := w.parseLogLevel(line)
+	require.Nil(t, err)
+	assert.Equal(t, zerolog.ErrorLevel, level)
+
+	event, ok := w.parseLogEvent(line)
+	require.True(t, ok)
+	assert.Equal(t, "dial timeout", event.Exception[0].Value)
+	assert.Equal(t, "wrapped", event.Extra["err"])
+
+	w.ReloadFieldNames()
+
+	event, ok = w.parseLogEvent(line)
+	require.True(t, ok)
+	assert.Equal(t, "wrapped", event.Exception[0].Value)
+	assert.Equal(t, "dial timeout", event.Extra["error"])
+	assert.Equal(t, "error", event.Extra["level"])
+}
+
+func TestParseLogEvent_ErrorTypeField(t *testing.T) {
+	w, err := New("", WithErrorTypeField("error_type"))
+	require.Nil(t, err)
+
+	event, ok := w.parseLogEvent([]byte(`{"level":"error","error_type":"*net.OpError","error":"dial timeout","message":"test message"}`))
+	require.True(t, ok)
+	assert.Equal(t, "*net.OpError", event.Exception[0].Type)
+	assert.NotContains(t, event.Extra, "error_type")
+
+	event, ok = w.parseLogEvent(logEventJSON)
+	require.True(t, ok)
+	assert.Equal(t, "test message", event.Exception[0].Type)
+}
+
+func TestParseLogEvent_TransactionField(t *testing.T) {
+	w, err := New("", WithTransactionField("operation"), WithCallerFrame())
+	require.Nil(t, err)
+
+	event, ok := w.parseLogEvent([]byte(`{"level":"error","operation":"GET /users","caller":"/app/handler.go:42","message":"test message"}`))
+	require.True(t, ok)
+	assert.Equal(t, "GET /users", event.Transaction)
+	assert.NotContains(t, event.Extra, "operation")
+
+	event, ok = w.parseLogEvent([]byte(`{"level":"error","caller":"/app/handler.go:42","message":"test message"}`))
+	require.True(t, ok)
+	assert.Equal(t, "/app/handler.go:42", event.Transaction)
+}
+
+func TestWrite_ServerNameField(t *testing.T) {
+	transport := &testTransport{}
+	writer, err := New("", WithTransport(transport), WithServerName("forwarder"), WithServerNameField("host"), WithSafeCopy())
+	require.Nil(t, err)
+
+	for _, line := range []string{
+		`{"level":"error","host":"web-1","message":"test message"}`,
+		`{"level":"error","host":"web-2","message":"test message"}`,
+		`{"level":"error","message":"test message"}`,
+	} {
+		_, err = writer.Write([]byte(line))
+		require.Nil(t, err)
+	}
+
+	require.Len(t, transport.events, 3)
+	assert.Equal(t, "web-1", transport.events[0].ServerName)
+	assert.Equal(t, "web-2", transport.events[1].ServerName)
+	assert.Equal(t, "forwarder", transport.events[2].ServerName)
+	assert.NotContains(t, transport.events[0].Extra, "host")
+}
+
+func TestWrite_EnvironmentField(t *testing.T) {
+	transport := &testTransport{}
+	writer, err := New("", WithTransport(transport), WithEnvironment("production"), WithEnvironmentField("env"), WithSafeCopy())
+	require.Nil(t, err)
+
+	for _, line := range []string{
+		`{"level":"error","env":"staging","message":"test message"}`,
+		`{"level":"error","message":"test message"}`,
+	} {
+		_, err = writer.Write([]byte(line))
+		require.Nil(t, err)
+	}
+
+	require.Len(t, transport.events, 2)
+	assert.Equal(t, "staging", transport.events[0].Environment)
+	assert.Equal(t, "production", transport.events[1].Environment)
+	assert.NotContains(t, transport.events[0].Extra, "env")
+}
+
+func TestParseLogEvent_MessageFieldName(t *testing.T) {
+	defer func() { zerolog.MessageFieldName = "message" }()
+	zerolog.MessageFieldName = "msg"
+
+	w, err := New("")
+	require.Nil(t, err)
+
+	event, ok := w.parseLogEvent([]byte(`{"level":"error","error":"dial timeout","msg":"test message"}`))
+	require.True(t, ok)
+	assert.Equal(t, "test message", event.Message)
+	assert.Equal(t, "test message", event.Exception[0].Type)
+
+	event, ok = w.parseLogEvent(logEventJSON)
+	require.True(t, ok)
+	assert.Empty(t, event.Message)
+	assert.Equal(t, "dial timeout", event.Exception[0].Type)
+}
+
+func TestParseLogLevel_DefaultLevel(t *testing.T) {
+	w, err := New("")
+	require.Nil(t, err)
+
+	level, err := w.parseLogLevel([]byte(`{"message":"test message"}`))
+	require.Nil(t, err)
+	assert.Equal(t, zerolog.Disabled, level)
+
+	w, err = New("", WithDefaultLevel(zerolog.ErrorLevel))
+	require.Nil(t, err)
+
+	level, err = w.parseLogLevel([]byte(`{"message":"test message"}`))
+	require.Nil(t, err)
+	assert.Equal(t, zerolog.ErrorLevel, level)
+
+	level, err = w.parseLogLevel([]byte(`{"level":"unknown","message":"test message"}`))
+	require.Nil(t, err)
+	assert.Equal(t, zerolog.ErrorLevel, level)
+
+	level, err = w.parseLogLevel([]byte(`{"level":"warn"}`))
+	require.Nil(t, err)
+	assert.Equal(t, zerolog.WarnLevel, level)
+}
+
+func TestLevelsMapping(t *testing.T) {
+	levels := []zerolog.Level{
+		zerolog.TraceLevel,
+		zerolog.DebugLevel,
+		zerolog.InfoLevel,
+		zerolog.WarnLevel,
+		zerolog.ErrorLevel,
+		zerolog.FatalLevel,
+		zerolog.PanicLevel,
+		zerolog.NoLevel,
+	}
+
+	for _, lvl := range levels {
+		var level sentry.Level
+		writer, err := New("",
+			WithLevels(lvl),
+			WithFlushTimeout(0),
+			WithBeforeSend(func(event *sentry.Event, hint *sentry.EventHint) *sentry.Event {
+				level = event.Level
+				return event
+			}))
+		require.Nil(t, err)
+
+		_, err = writer.WriteLevel(lvl, logEventJSON)
+		require.Nil(t, err)
+		assert.NotEmpty(t, level, "level %s", lvl)
+	}
+}
+
+func TestWithCaptureLevel(t *testing.T) {
+	tests := map[string]struct {
+		opts []WriterOption
+		want []zerolog.Level
+	}{
+		"warn": {
+			opts: []WriterOption{WithCaptureLevel(zerolog.WarnLevel)},
+			want: []zerolog.Level{zerolog.WarnLevel, zerolog.ErrorLevel, zerolog.FatalLevel, zerolog.PanicLevel},
+		},
+		"trace": {
+			opts: []WriterOption{WithCaptureLevel(zerolog.TraceLevel)},
+			want: []zerolog.Level{
+				zerolog.TraceLevel, zerolog.DebugLevel, zerolog.InfoLevel, zerolog.WarnLevel,
+				zerolog.ErrorLevel, zerolog.FatalLevel, zerolog.PanicLevel,
+			},
+		},
+		"replaces_levels": {
+			opts: []WriterOption{WithLevels(zerolog.DebugLevel), WithCaptureLevel(zerolog.FatalLevel)},
+			want: []zerolog.Level{zerolog.FatalLevel, zerolog.PanicLevel},
+		},
+		"replaced_by_levels": {
+			opts: []WriterOption{WithCaptureLevel(zerolog.DebugLevel), WithLevels(zerolog.InfoLevel)},
+			want: []zerolog.Level{zerolog.InfoLevel},
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			cfg := newDefaultConfig()
+			for _, opt := range tt.opts {
+				opt.apply(&cfg)
+			}
+			assert.Equal(t, tt.want, cfg.levels)
+		})
+	}
+
+	transport := &testTransport{}
+	writer, err := New("", WithTransport(transport), WithCaptureLevel(zerolog.WarnLevel))
+	require.Nil(t, err)
+
+	log := zerolog.New(writer)
+	log.Info().Msg("skipped")
+	log.Warn().Msg("test message")
+	assert.Len(t, transport.events, 1)
+}
+
+func TestWrite_MessageOnlyLevels(t *testing.T) {
+	transport := &testTransport{}
+	writer, err := New("",
+		WithTransport(transport),
+		WithSafeCopy(),
+		WithLevels(zerolog.WarnLevel, zerolog.ErrorLevel),
+		WithErrorFieldNames("cause"),
+		WithMessageOnlyLevels(zerolog.WarnLevel))
+	require.Nil(t, err)
+
+	log := zerolog.New(writer)
+	log.Warn().Str("cause", "pool exhausted").Err(errors.New("dial timeout")).Msg("retrying")
+	log.Error().Err(errors.New("dial timeout")).Msg("test message")
+
+	require.Len(t, transport.events, 2)
+	event := transport.events[0]
+	assert.Equal(t, "retrying", event.Message)
+	assert.Empty(t, event.Exception)
+	assert.Equal(t, map[string]interface{}{"cause": "pool exhausted", "error": "dial timeout"}, event.Extra)
+	assert.Len(t, transport.events[1].Exception, 1)
+
+	transport = &testTransport{}
+	writer, err = New("",
+		WithTransport(transport),
+		WithSafeCopy(),
+		WithSyntheticException(),
+		WithMessageOnlyLevels(zerolog.ErrorLevel))
+	require.Nil(t, err)
+
+	log = zerolog.New(writer)
+	log.Error().Err(errors.New("dial timeout")).Msg("test message")
+	log.Error().Msg("test message")
+
+	require.Len(t, transport.events, 2)
+	for _, event := range transport.events {
+		assert.Empty(t, event.Exception)
+	}
+	assert.Equal(t, "dial timeout", transport.events[0].Extra["error"])
+}
+
+func TestWrite_SyntheticException(t *testing.T) {
+	transport := &testTransport{}
+	writer, err := New("",
+		WithTransport(transport),
+		WithSafeCopy(),
+		WithLevels(zerolog.WarnLevel, zerolog.ErrorLevel),
+		WithSyntheticException())
+	require.Nil(t, err)
+
+	log := zerolog.New(writer)
+	log.Warn().Msg("slow query")
+	log.Error().Msg("payment declined")
+	log.Error().Err(errors.New("dial timeout")).Msg("test message")
+
+	require.Len(t, transport.events, 3)
+	assert.Empty(t, transport.events[0].Exception)
+
+	require.Len(t, transport.events[1].Exception, 1)
+	exc := transport.events[1].Exception[0]
+	assert.Equal(t, "error", exc.Type)
+	assert.Equal(t, "payment declined", exc.Value)
+	assert.NotNil(t, exc.Stacktrace)
+
+	require.Len(t, transport.events[2].Exception, 1)
+	assert.Equal(t, "dial timeout", transport.events[2].Exception[0].Value)
+}
+
+func TestWrite_LevelTag(t *testing.T) {
+	transport := &testTransport{}
+	writer, err := New("", WithTransport(transport), WithLevels(zerolog.PanicLevel), WithLevelTag("zerolog_level"))
+	require.Nil(t, err)
+
+	_, err = writer.Write([]byte(`{"level":"panic","message":"test message"}`))
+	require.Nil(t, err)
+	writer.WriteError(io.ErrUnexpectedEOF, zerolog.PanicLevel)
+
+	require.Len(t, transport.events, 2)
+	assert.Equal(t, sentry.LevelFatal, transport.events[0].Level)
+	assert.Equal(t, "panic", transport.events[0].Tags["zerolog_level"])
+	assert.Equal(t, "panic", transport.events[1].Tags["zerolog_level"])
+}
+
+func TestWriteLevel_LevelMapping(t *testing.T) {
+	var level sentry.Level
+	writer, err := New("",
+		WithLevels(zerolog.WarnLevel, zerolog.ErrorLevel),
+		WithLevelMapping(map[zerolog.Level]sentry.Level{zerolog.WarnLevel: sentry.LevelError}),
+		WithBeforeSend(func(event *sentry.Event, hint *sentry.EventHint) *sentry.Event {
+			level = event.Level
+			return event
+		}))
+	require.Nil(t, err)
+
+	_, _ = writer.WriteLevel(zerolog.WarnLevel, logEventJSON)
+	assert.Equal(t, sentry.LevelError, level)
+
+	_, _ = writer.WriteLevel(zerolog.ErrorLevel, logEventJSON)
+	assert.Equal(t, sentry.LevelError, level)
+	assert.Equal(t, sentry.LevelWarning, levelsMapping[zerolog.WarnLevel])
+}
+
+func TestWrite(t *testing.T) {
+	beforeSendCalled := false
+	writer, err := New("", WithBeforeSend(func(event *sentry.Event, hint *sentry.EventHint) *sentry.Event {
+		assert.Equal(t, sentry.LevelError, event.Level)
+		assert.Equal(t, "test message", event.Message)
+		require.Len(t, event.Exception, 1)
+		assert.Equal(t, "dial timeout", event.Exception[0].Value)
+		assert.True(t, time.Since(event.Timestamp).Minutes() < 1)
+		assert.Equal(t, "bee07485-2485-4f64-99e1-d10165884ca7", event.Extra["requestId"])
+		beforeSendCalled = true
+		return event
+	}))
+	require.Nil(t, err)
+
+	var zerologError error
+	zerolog.ErrorHandler = func(err error) {
+		zerologError = err
+	}
+
+	// use io.MultiWriter to enforce using the Write() method
+	log := zerolog.New(io.MultiWriter(writer)).With().Timestamp().
+		Str("requestId", "bee07485-2485-4f64-99e1-d10165884ca7").
+		Logger()
+	log.Err(errors.New("dial timeout")).
+		Msg("test message")
+
+	require.Nil(t, zerologError)
+	require.True(t, beforeSendCalled)
+}
+
+func TestWrite_RawLogLineHint(t *testing.T) {
+	line := []byte(`{"level":"error","status":503,"latency":0.25,"retry":true,"message":"test message"}`)
+
+	var slow []string
+	var hints []interface{}
+	beforeSend := WithBeforeSend(func(event *sentry.Event, hint *sentry.EventHint) *sentry.Event {
+		if status, ok := event.Extra["status"].(int64); ok && status >= 500 {
+			slow = append(slow, event.Message)
+		}
+		assert.Equal(t, 0.25, event.Extra["latency"])
+		assert.Equal(t, true, event.Extra["retry"])
+		var data interface{}
+		if hint != nil {
+			data = hint.Data
+		}
+		hints = append(hints, data)
+		return event
+	})
+
+	writer, err := New("", beforeSend, WithRawLogLineHint())
+	require.Nil(t, err)
+	_, err = writer.Write(line)
+	require.Nil(t, err)
+
+	writer, err = New("", beforeSend)
+	require.Nil(t, err)
+	_, err = writer.Write(line)
+	require.Nil(t, err)
+
+	assert.Equal(t, []string{"test message", "test message"}, slow)
+	require.Len(t, hints, 2)
+	assert.Equal(t, RawLogLine(line), hints[0])
+	assert.Nil(t, hints[1])
+}
+
+func TestWriteLevel(t *testing.T) {
+	beforeSendCalled := false
+	writer, err := New("", WithBeforeSend(func(event *sentry.Event, hint *sentry.EventHint) *sentry.Event {
+		assert.Equal(t, sentry.LevelError, event.Level)
+		assert.Equal(t, "test message", event.Message)
+		require.Len(t, event.Exception, 1)
+		assert.Equal(t, "dial timeout", event.Exception[0].Value)
+		assert.True(t, time.Since(event.Timestamp).Minutes() < 1)
+		assert.Equal(t, "bee07485-2485-4f64-99e1-d10165884ca7", event.Extra["requestId"])
+		beforeSendCalled = true
+		return event
+	}))
+	require.Nil(t, err)
+
+	var zerologError error
+	zerolog.ErrorHandler = func(err error) {
+		zerologError = err
+	}
+
+	log := zerolog.New(writer).With().Timestamp().
+		Str("requestId", "bee07485-2485-4f64-99e1-d10165884ca7").
+		Logger()
+	log.Err(errors.New("dial timeout")).
+		Msg("test message")
+
+	require.Nil(t, zerologError)
+	require.True(t, beforeSendCalled)
+}
+
+func TestWrite_Breadcrumbs(t *testing.T) {
+	var events []*sentry.Event
+	writer, err := New("",
+		WithBreadcrumbLevels(zerolog.InfoLevel, zerolog.WarnLevel),
+		WithMaxBreadcrumbs(2),
+		WithErrorFieldNames("cause"),
+		WithBeforeSend(func(event *sentry.Event, hint *sentry.EventHint) *sentry.Event {
+			events = append(events, event)
+			return event
+		}))
+	require.Nil(t, err)
+	writer.hub.Scope().ClearBreadcrumbs()
+	defer writer.hub.Scope().ClearBreadcrumbs()
+
+	log := zerolog.New(writer)
+	log.Debug().Msg("skipped")
+	log.Info().Msg("first step")
+	log.Info().Int("attempt", 1).Msg("second step")
+	log.Warn().Str("cause", "pool exhausted").Err(errors.New("slow response")).Msg("third step")
+	require.Empty(t, events)
+
+	log.Err(errors.New("dial timeout")).Msg("test message")
+	require.Len(t, events, 1)
+
+	breadcrumbs := events[0].Breadcrumbs
+	require.Len(t, breadcrumbs, 2)
+	assert.Equal(t, "second step", breadcrumbs[0].Message)
+	assert.Equal(t, sentry.LevelInfo, breadcrumbs[0].Level)
+	assert.Equal(t, int64(1), breadcrumbs[0].Data["attempt"])
+	assert.Equal(t, "third step", breadcrumbs[1].Message)
+	assert.Equal(t, sentry.LevelWarning, breadcrumbs[1].Level)
+	assert.Equal(t, "slow response", breadcrumbs[1].Data["error"])
+	assert.Equal(t, "pool exhausted", breadcrumbs[1].Data["cause"])
+}
+
+func TestWrite_BreadcrumbsSkipEventProcessing(t *testing.T) {
+	var mutated, fingerprinted int
+	transport := &testTransport{}
+	writer, err := New("",
+		WithTransport(transport),
+		WithBreadcrumbLevels(zerolog.InfoLevel),
+		WithRedactFields("password"),
+		WithEventMutator(func(event *sentry.Event, raw []byte) { mutated++ }),
+		WithFingerprintFunc(func(event *sentry.Event) []string {
+			fingerprinted++
+			return nil
+		}))
+	require.Nil(t, err)
+	writer.hub.Scope().ClearBreadcrumbs()
+	defer writer.hub.Scope().ClearBreadcrumbs()
+
+	log := zerolog.New(writer).With().Timestamp().Logger()
+	log.Info().Err(errors.New("cache miss")).Str("password", "hunter2").Int("attempt", 2).Msg("retrying")
+	assert.Zero(t, mutated)
+	assert.Zero(t, fingerprinted)
+
+	log.Error().Msg("test message")
+	require.Len(t, transport.events, 1)
+	assert.Equal(t, 1, mutated)
+	assert.Equal(t, 1, fingerprinted)
+
+	require.Len(t, transport.events[0].Breadcrumbs, 1)
+	breadcrumb := transport.events[0].Breadcrumbs[0]
+	assert.Equal(t, "retrying", breadcrumb.Message)
+	assert.Equal(t, sentry.LevelInfo, breadcrumb.Level)
+	assert.Equal(t, map[string]interface{}{"error": "cache miss", "password": Redacted, "attempt": int64(2)}, breadcrumb.Data)
+}
+
+func TestWriteLevelContext_SpanContext(t *testing.T) {
+	transport := &testTransport{}
+	writer, err := New("", WithTransport(transport), WithTraceContextFields("trace_id", "span_id"))
+	require.Nil(t, err)
+
+	traceID := trace.TraceID{0x4b, 0xf9, 0x2f, 0x35, 0x77, 0xb3, 0x4d, 0xa6, 0xa3, 0xce, 0x92, 0x9d, 0x0e, 0x0e, 0x47, 0x36}
+	spanID := trace.SpanID{0x00, 0xf0, 0x67, 0xaa, 0x0b, 0xa9, 0x02, 0xb7}
+	ctx := trace.ContextWithSpanContext(context.Background(), trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID: traceID,
+		SpanID:  spanID,
+	}))
+
+	_, err = writer.WriteLevelContext(ctx, zerolog.ErrorLevel, logEventJSON)
+	require.Nil(t, err)
+	_, err = writer.WriteLevelContext(ctx, zerolog.ErrorLevel, []byte(`{"level":"error","trace_id":"0af7651916cd43dd8448eb211c80319c","message":"test message"}`))
+	require.Nil(t, err)
+	_, err = writer.WriteLevelContext(context.Background(), zerolog.ErrorLevel, logEventJSON)
+	require.Nil(t, err)
+
+	require.Len(t, transport.events, 3)
+	assert.Equal(t, sentry.TraceID(traceID), transport.events[0].Contexts["trace"]["trace_id"])
+	assert.Equal(t, sentry.SpanID(spanID), transport.events[0].Contexts["trace"]["span_id"])
+	assert.NotEqual(t, sentry.TraceID(traceID), transport.events[1].Contexts["trace"]["trace_id"])
+	assert.NotContains(t, transport.events[2].Contexts, "trace")
+}
+
+func TestWriteLevelContext(t *testing.T) {
+	var tags map[string]string
+	writer, err := New("", WithBeforeSend(func(event *sentry.Event, hint *sentry.EventHint) *sentry.Event {
+		tags = event.Tags
+		return event
+	}))
+	require.Nil(t, err)
+
+	hub := writer.hub.Clone()
+	hub.Scope().SetTag("route", "/users")
+	ctx := sentry.SetHubOnContext(context.Background(), hub)
+
+	_, err = writer.WriteLevelContext(ctx, zerolog.ErrorLevel, logEventJSON)
+	require.Nil(t, err)
+	assert.Equal(t, "/users", tags["route"])
+
+	tags = nil
+	_, err = writer.WriteLevelContext(context.Background(), zerolog.ErrorLevel, logEventJSON)
+	require.Nil(t, err)
+	assert.NotContains(t, tags, "route")
+}
+
+type testTransport struct {
+	mu      sync.Mutex
+	events  []*sentry.Event
+	flushes int
+	timeout time.Duration
+}
+
+func (t *testTransport) Configure(sentry.ClientOptions) {}
+
+func (t *testTransport) SendEvent(event *sentry.Event) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.events = append(t.events, event)
+}
+
+func (t *testTransport) Flush(timeout time.Duration) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.flushes++
+	t.timeout = timeout
+	return true
+}
+
+func TestWrite_Transport(t *testing.T) {
+	transport := &testTransport{}
+	writer, err := New("", WithTransport(transport))
+	require.Nil(t, err)
+
+	log := zerolog.New(writer)
+	log.Info().Msg("skipped")
+	log.Err(errors.New("dial timeout")).Msg("test message")
+
+	require.Len(t, transport.events, 1)
+	assert.Equal(t, "test message", transport.events[0].Message)
+}
+
+func TestWriteLevel_FlushOnPanicRemapped(t *testing.T) {
+	transport := &testTransport{}
+	writer, err := New("",
+		WithTransport(transport),
+		WithLevels(zerolog.ErrorLevel, zerolog.PanicLevel),
+		WithLevelMapping(map[zerolog.Level]sentry.Level{zerolog.PanicLevel: sentry.LevelError}))
+	require.Nil(t, err)
+
+	_, err = writer.WriteLevel(zerolog.ErrorLevel, logEventJSON)
+	require.Nil(t, err)
+	assert.Equal(t, 0, transport.flushes)
+
+	_, err = writer.WriteLevel(zerolog.PanicLevel, logEventJSON)
+	require.Nil(t, err)
+	assert.Equal(t, 1, transport.flushes)
+	assert.Equal(t, sentry.LevelError, transport.events[1].Level)
+}
+
+func TestHub(t *testing.T) {
+	var tags map[string]string
+	hub := sentry.NewHub(nil, sentry.NewScope())
+	writer, err := NewWithHub(hub)
+	require.Nil(t, err)
+	require.Same(t, hub, writer.Hub())
+
+	client, err := sentry.NewClient(sentry.ClientOptions{
+		BeforeSend: func(event *sentry.Event, hint *sentry.EventHint) *sentry.Event {
+			tags = event.Tags
+			return event
+		},
+	})
+	require.Nil(t, err)
+	writer.Hub().BindClient(client)
+	writer.Hub().Scope().SetTag("region", "eu")
+
+	_, err = writer.WriteLevel(zerolog.ErrorLevel, logEventJSON)
+	require.Nil(t, err)
+	assert.Equal(t, "eu", tags["region"])
+}
+
+func TestWithScope(t *testing.T) {
+	var tags []map[string]string
+	client, err := sentry.NewClient(sentry.ClientOptions{
+		BeforeSend: func(event *sentry.Event, hint *sentry.EventHint) *sentry.Event {
+			tags = append(tags, event.Tags)
+			return event
+		},
+	})
+	require.Nil(t, err)
+
+	writer, err := NewWithClient(client)
+	require.Nil(t, err)
+
+	scoped := writer.WithScope()
+	scoped.Hub().Scope().SetTag("request_id", "r-1")
+
+	_, err = scoped.WriteLevel(zerolog.ErrorLevel, logEventJSON)
+	require.Nil(t, err)
+	_, err = writer.WriteLevel(zerolog.ErrorLevel, logEventJSON)
+	require.Nil(t, err)
+
+	require.Len(t, tags, 2)
+	assert.Equal(t, "r-1", tags[0]["request_id"])
+	assert.NotContains(t, tags[1], "request_id")
+
+	writer.SetLevels(zerolog.FatalLevel)
+	_, err = scoped.WriteLevel(zerolog.ErrorLevel, logEventJSON)
+	require.Nil(t, err)
+	assert.Len(t, tags, 2)
+	assert.Equal(t, uint64(1), writer.DroppedEvents())
+}
+
+func TestCloseContext(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+
+	writer, err := New("",
+		WithAsync(1),
+		WithBeforeSend(func(event *sentry.Event, hint *sentry.EventHint) *sentry.Event {
+			<-release
+			return event
+		}))
+	require.Nil(t, err)
+
+	_, err = writer.WriteLevel(zerolog.ErrorLevel, logEventJSON)
+	require.Nil(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.ErrorIs(t, writer.CloseContext(ctx), context.Canceled)
+
+	writer, err = New("")
+	require.Nil(t, err)
+	assert.Nil(t, writer.CloseContext(context.Background()))
+}
+
+func TestLastCaptureFailed(t *testing.T) {
+	drop := true
+	writer, err := New("", WithBeforeSend(func(event *sentry.Event, hint *sentry.EventHint) *sentry.Event {
+		if drop {
+			return nil
+		}
+		return event
+	}))
+	require.Nil(t, err)
+	assert.False(t, writer.LastCaptureFailed())
+
+	_, err = writer.WriteLevel(zerolog.ErrorLevel, logEventJSON)
+	require.Nil(t, err)
+	assert.True(t, writer.LastCaptureFailed())
+	assert.Equal(t, uint64(1), writer.DroppedEvents())
+
+	drop = false
+	_, err = writer.WriteLevel(zerolog.ErrorLevel, logEventJSON)
+	require.Nil(t, err)
+	assert.False(t, writer.LastCaptureFailed())
+}
+
+func TestFlush(t *testing.T) {
+	transport := &testTransport{}
+	writer, err := New("", WithTransport(transport))
+	require.Nil(t, err)
+
+	_, err = writer.WriteLevel(zerolog.ErrorLevel, logEventJSON)
+	require.Nil(t, err)
+
+	assert.True(t, writer.Flush(time.Second))
+	assert.Equal(t, 1, transport.flushes)
+
+	_, err = writer.WriteLevel(zerolog.ErrorLevel, logEventJSON)
+	require.Nil(t, err)
+	assert.Len(t, transport.events, 2)
+}
+
+func TestReconfigure(t *testing.T) {
+	transport := &testTransport{}
+	writer, err := New("", WithTransport(transport), WithLevels(zerolog.ErrorLevel))
+	require.Nil(t, err)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				_, _ = writer.WriteLevel(zerolog.WarnLevel, logEventJSON)
+			}
+		}()
+	}
+	writer.Reconfigure(WithLevels(zerolog.WarnLevel), WithLevelSampleRates(map[zerolog.Level]float64{zerolog.WarnLevel: 1}))
+	wg.Wait()
+
+	transport.mu.Lock()
+	sent := len(transport.events)
+	transport.mu.Unlock()
+
+	_, err = writer.WriteLevel(zerolog.WarnLevel, logEventJSON)
+	require.Nil(t, err)
+	_, err = writer.WriteLevel(zerolog.ErrorLevel, logEventJSON)
+	require.Nil(t, err)
+	assert.Len(t, transport.events, sent+1)
+	assert.Equal(t, uint64(400-sent+1), writer.DroppedEvents())
+}
+
+func TestSetLevels(t *testing.T) {
+	transport := &testTransport{}
+	writer, err := New("", WithTransport(transport), WithSafeCopy())
+	require.Nil(t, err)
+
+	log := zerolog.New(writer)
+	log.Debug().Msg("skipped")
+	require.Len(t, transport.events, 0)
+
+	writer.SetLevels(zerolog.DebugLevel)
+	log.Debug().Msg("sent")
+	log.Error().Msg("skipped")
+	require.Len(t, transport.events, 1)
+	assert.Equal(t, "sent", transport.events[0].Message)
+	assert.Equal(t, sentry.LevelDebug, transport.events[0].Level)
+}
+
+func TestNew_BeforeSendTransaction(t *testing.T) {
+	transport := &testTransport{}
+	_, err := New("",
+		WithTransport(transport),
+		WithTracing(),
+		WithTracingSampleRate(1),
+		WithBeforeSendTransaction(func(event *sentry.Event, hint *sentry.EventHint) *sentry.Event {
+			if event.Transaction == "GET /health" {
+				return nil
+			}
+			return event
+		}))
 	require.Nil(t, err)
-	assert.Equal(t, zerolog.ErrorLevel, level)
+
+	sentry.StartTransaction(context.Background(), "GET /health").Finish()
+	sentry.StartTransaction(context.Background(), "GET /users").Finish()
+
+	require.Len(t, transport.events, 1)
+	assert.Equal(t, "GET /users", transport.events[0].Transaction)
 }
 
-func TestWrite(t *testing.T) {
-	beforeSendCalled := false
-	writer, err := New("", WithBeforeSend(func(event *sentry.Event, hint *sentry.EventHint) *sentry.Event {
-		assert.Equal(t, sentry.LevelError, event.Level)
-		assert.Equal(t, "test message", event.Message)
-		require.Len(t, event.Exception, 1)
-		assert.Equal(t, "dial timeout", event.Exception[0].Value)
-		assert.True(t, time.Since(event.Timestamp).Minutes() < 1)
-		assert.Equal(t, "bee07485-2485-4f64-99e1-d10165884ca7", event.Extra["requestId"])
-		beforeSendCalled = true
-		return event
-	}))
+func TestWrite_IgnoreMessages(t *testing.T) {
+	transport := &testTransport{}
+	writer, err := New("", WithTransport(transport), WithSafeCopy(), WithIgnoreMessages("context canceled", "EOF"))
 	require.Nil(t, err)
 
-	var zerologError error
-	zerolog.ErrorHandler = func(err error) {
-		zerologError = err
-	}
+	log := zerolog.New(writer)
+	log.Error().Msg("read body: unexpected EOF")
+	log.Error().Msg("query: context canceled")
+	log.Error().Msg("dial timeout")
 
-	// use io.MultiWriter to enforce using the Write() method
-	log := zerolog.New(io.MultiWriter(writer)).With().Timestamp().
-		Str("requestId", "bee07485-2485-4f64-99e1-d10165884ca7").
-		Logger()
-	log.Err(errors.New("dial timeout")).
-		Msg("test message")
+	require.Len(t, transport.events, 1)
+	assert.Equal(t, "dial timeout", transport.events[0].Message)
+	assert.Equal(t, uint64(2), writer.DroppedEvents())
+}
 
-	require.Nil(t, zerologError)
-	require.True(t, beforeSendCalled)
+func TestWrite_DropFunc(t *testing.T) {
+	var levels []zerolog.Level
+	transport := &testTransport{}
+	writer, err := New("",
+		WithTransport(transport),
+		WithDropFunc(func(level zerolog.Level, fields map[string]interface{}) bool {
+			levels = append(levels, level)
+			return fields["service"] == "cache" && fields[zerolog.ErrorFieldName] == context.Canceled.Error()
+		}))
+	require.Nil(t, err)
+
+	log := zerolog.New(writer)
+	log.Info().Str("service", "cache").Err(context.Canceled).Msg("skipped")
+	log.Error().Str("service", "cache").Err(context.Canceled).Msg("dropped")
+	log.Error().Str("service", "db").Err(context.Canceled).Msg("sent")
+
+	assert.Len(t, transport.events, 1)
+	assert.Equal(t, []zerolog.Level{zerolog.ErrorLevel, zerolog.ErrorLevel}, levels)
+	assert.Equal(t, uint64(2), writer.DroppedEvents())
 }
 
-func TestWriteLevel(t *testing.T) {
-	beforeSendCalled := false
-	writer, err := New("", WithBeforeSend(func(event *sentry.Event, hint *sentry.EventHint) *sentry.Event {
-		assert.Equal(t, sentry.LevelError, event.Level)
-		assert.Equal(t, "test message", event.Message)
-		require.Len(t, event.Exception, 1)
-		assert.Equal(t, "dial timeout", event.Exception[0].Value)
-		assert.True(t, time.Since(event.Timestamp).Minutes() < 1)
-		assert.Equal(t, "bee07485-2485-4f64-99e1-d10165884ca7", event.Extra["requestId"])
-		beforeSendCalled = true
-		return event
-	}))
+func TestWrite_RuntimeContext(t *testing.T) {
+	defer func() { random = rand.Float64 }()
+
+	transport := &testTransport{}
+	writer, err := New("", WithTransport(transport), WithRuntimeContext(0.5))
 	require.Nil(t, err)
 
-	var zerologError error
-	zerolog.ErrorHandler = func(err error) {
-		zerologError = err
-	}
+	random = func() float64 { return 0.7 }
+	_, err = writer.WriteLevel(zerolog.ErrorLevel, logEventJSON)
+	require.Nil(t, err)
 
-	log := zerolog.New(writer).With().Timestamp().
-		Str("requestId", "bee07485-2485-4f64-99e1-d10165884ca7").
-		Logger()
-	log.Err(errors.New("dial timeout")).
-		Msg("test message")
+	random = func() float64 { return 0.2 }
+	_, err = writer.WriteLevel(zerolog.ErrorLevel, logEventJSON)
+	require.Nil(t, err)
 
-	require.Nil(t, zerologError)
-	require.True(t, beforeSendCalled)
+	require.Len(t, transport.events, 2)
+	ctx := transport.events[0].Contexts["go_runtime"]
+	assert.Equal(t, runtime.NumCPU(), ctx["num_cpu"])
+	assert.Contains(t, ctx, "num_goroutine")
+	assert.NotContains(t, ctx, "mem_alloc")
+
+	ctx = transport.events[1].Contexts["go_runtime"]
+	assert.NotZero(t, ctx["mem_alloc"])
+	assert.NotZero(t, ctx["mem_sys"])
+}
+
+func TestCapturePanic(t *testing.T) {
+	transport := &testTransport{}
+	writer, err := New("", WithTransport(transport), WithLevels(zerolog.ErrorLevel, zerolog.PanicLevel))
+	require.Nil(t, err)
+
+	func() {
+		defer func() {
+			writer.CapturePanic(recover(), zerolog.ErrorLevel)
+		}()
+		panic("index out of range")
+	}()
+	writer.CapturePanic(nil, zerolog.PanicLevel)
+	writer.CapturePanic(io.ErrUnexpectedEOF, zerolog.PanicLevel)
+
+	require.Len(t, transport.events, 2)
+	assert.Equal(t, 2, transport.flushes)
+
+	exc := transport.events[0].Exception[0]
+	assert.Equal(t, "string", exc.Type)
+	assert.Equal(t, "index out of range", exc.Value)
+	assert.NotNil(t, exc.Stacktrace)
+	assert.Equal(t, sentry.LevelError, transport.events[0].Level)
+
+	exc = transport.events[1].Exception[0]
+	assert.Equal(t, "*errors.errorString", exc.Type)
+	assert.Equal(t, io.ErrUnexpectedEOF.Error(), exc.Value)
+}
+
+func TestWrite_MultipleLines(t *testing.T) {
+	transport := &testTransport{}
+	writer, err := New("", WithTransport(transport), WithSafeCopy(), WithLevels(zerolog.WarnLevel, zerolog.ErrorLevel))
+	require.Nil(t, err)
+
+	data := []byte(`{"level":"error","message":"first"}` + "\n" +
+		`{"level":"info","message":"skipped"}` + "\n\n" +
+		`{"level":"warn","message":"second"}` + "\n" +
+		`{"level":"error","error":"dial timeout","message":"third"}` + "\n")
+	n, err := writer.Write(data)
+	require.Nil(t, err)
+	assert.Equal(t, len(data), n)
+
+	require.Len(t, transport.events, 3)
+	assert.Equal(t, "first", transport.events[0].Message)
+	assert.Equal(t, "second", transport.events[1].Message)
+	assert.Equal(t, sentry.LevelWarning, transport.events[1].Level)
+	assert.Equal(t, "third", transport.events[2].Message)
+	assert.Equal(t, "dial timeout", transport.events[2].Exception[0].Value)
+
+	// lines after malformed ones are still captured
+	transport.events = nil
+	writer, err = New("", WithTransport(transport), WithSafeCopy(), WithStrictParsing())
+	require.Nil(t, err)
+
+	n, err = writer.Write([]byte("bogus\n" + `{"level":"error","message":"first"}` + "\n[1]\n"))
+	assert.ErrorIs(t, err, ErrMalformedLogEvent)
+	assert.Equal(t, 2, strings.Count(err.Error(), ErrMalformedLogEvent.Error()), err.Error())
+	assert.Equal(t, len("bogus\n"+`{"level":"error","message":"first"}`+"\n[1]\n"), n)
+	require.Len(t, transport.events, 1)
+	assert.Equal(t, "first", transport.events[0].Message)
 }
 
 func TestWrite_Disabled(t *testing.T) {
@@ -134,6 +1792,232 @@ func TestWrite_Disabled(t *testing.T) {
 	require.False(t, beforeSendCalled)
 }
 
+func TestWrite_DroppedEvents(t *testing.T) {
+	var reasons []DropReason
+	writer, err := New("",
+		WithOnDrop(func(reason DropReason) {
+			reasons = append(reasons, reason)
+		}),
+		WithBeforeSend(func(event *sentry.Event, hint *sentry.EventHint) *sentry.Event {
+			if event.Message == "discarded" {
+				return nil
+			}
+			return event
+		}))
+	require.Nil(t, err)
+
+	log := zerolog.New(writer)
+	log.Info().Msg("disabled")
+	log.Error().Msg("discarded")
+	log.Error().Msg("sent")
+
+	assert.Equal(t, uint64(2), writer.DroppedEvents())
+	assert.Equal(t, []DropReason{DropReasonLevelDisabled, DropReasonClient}, reasons)
+}
+
+func TestWrite_SafeCopy(t *testing.T) {
+	var retained *sentry.Event
+	writer, err := New("",
+		WithSafeCopy(),
+		WithBeforeSend(func(event *sentry.Event, hint *sentry.EventHint) *sentry.Event {
+			retained = event
+			return event
+		}))
+	require.Nil(t, err)
+
+	data := append([]byte(nil), logEventJSON...)
+	_, err = writer.Write(data)
+	require.Nil(t, err)
+	require.NotNil(t, retained)
+
+	for i := range data {
+		data[i] = 'x'
+	}
+
+	assert.Equal(t, "test message", retained.Message)
+	assert.Equal(t, "dial timeout", retained.Exception[0].Value)
+	assert.Equal(t, "bee07485-2485-4f64-99e1-d10165884ca7", retained.Extra["requestId"])
+}
+
+func TestWrite_LevelSampleRates(t *testing.T) {
+	defer func() { random = rand.Float64 }()
+
+	sent := 0
+	writer, err := New("",
+		WithLevels(zerolog.WarnLevel, zerolog.ErrorLevel, zerolog.FatalLevel),
+		WithLevelSampleRates(map[zerolog.Level]float64{
+			zerolog.WarnLevel:  0.1,
+			zerolog.ErrorLevel: 2,
+		}),
+		WithBeforeSend(func(event *sentry.Event, hint *sentry.EventHint) *sentry.Event {
+			sent++
+			return event
+		}))
+	require.Nil(t, err)
+	assert.Equal(t, 1.0, writer.settings.Load().sampleRates[zerolog.ErrorLevel])
+
+	random = func() float64 { return 0.5 }
+
+	_, _ = writer.WriteLevel(zerolog.WarnLevel, logEventJSON)
+	assert.Equal(t, 0, sent)
+	assert.Equal(t, uint64(1), writer.DroppedEvents())
+
+	_, _ = writer.WriteLevel(zerolog.ErrorLevel, logEventJSON)
+	assert.Equal(t, 1, sent)
+
+	random = func() float64 { return 0.05 }
+
+	_, _ = writer.WriteLevel(zerolog.WarnLevel, logEventJSON)
+	assert.Equal(t, 2, sent)
+}
+
+func TestWrite_RedactFields(t *testing.T) {
+	transport := &testTransport{}
+	writer, err := New("", WithTransport(transport), WithRedactFields("password", "Authorization"))
+	require.Nil(t, err)
+
+	log := zerolog.New(writer)
+	log.Error().
+		Str("Password", "hunter2").
+		Str("authorization", "Bearer secret").
+		Str("login", "john").
+		Msg("test message")
+
+	require.Len(t, transport.events, 1)
+	extra := transport.events[0].Extra
+	assert.Equal(t, Redacted, extra["Password"])
+	assert.Equal(t, Redacted, extra["authorization"])
+	assert.Equal(t, "john", extra["login"])
+	for _, v := range extra {
+		assert.NotEqual(t, "hunter2", v)
+		assert.NotEqual(t, "Bearer secret", v)
+	}
+}
+
+func TestParseLogEvent_RedactNestedFields(t *testing.T) {
+	w, err := New("",
+		WithRedactFields("password"),
+		WithRedactPatterns(regexp.MustCompile(`[a-z]+@acme\.com`)),
+		WithBreadcrumbsField("trail"))
+	require.Nil(t, err)
+
+	ev, ok := w.parseLogEvent([]byte(`{"level":"error","message":"test message","password":"top",` +
+		`"auth":{"password":"nested","user":"john"},"http":{"password":"ctx"},` +
+		`"attempts":[{"password":"in array"},2],"trail":[{"message":"login","password":"crumb"}]}`))
+	require.True(t, ok)
+	assert.Equal(t, Redacted, ev.Extra["password"])
+	assert.Equal(t, map[string]interface{}{"password": Redacted, "user": "john"}, ev.Extra["auth"])
+	assert.Equal(t, Redacted, ev.Contexts["http"]["password"])
+	assert.Equal(t, `[{"password":"[REDACTED]"},2]`, ev.Extra["attempts"])
+	require.Len(t, ev.Breadcrumbs, 1)
+	assert.Equal(t, "login", ev.Breadcrumbs[0].Message)
+	assert.Equal(t, Redacted, ev.Breadcrumbs[0].Data["password"])
+
+	ev, ok = w.parseLogEvent([]byte(`{"level":"error","message":"test message","fingerprint":["bob@acme.com","checkout"]}`))
+	require.True(t, ok)
+	assert.Equal(t, []string{Redacted, "checkout"}, ev.Fingerprint)
+
+	w, err = New("", WithRedactFields("fingerprint"))
+	require.Nil(t, err)
+	ev, ok = w.parseLogEvent([]byte(`{"level":"error","message":"test message","fingerprint":["bob"]}`))
+	require.True(t, ok)
+	assert.Equal(t, []string{"test message"}, ev.Fingerprint)
+}
+
+func TestParseLogEvent_RedactPatterns(t *testing.T) {
+	w, err := New("", WithRedactPatterns(regexp.MustCompile(`[a-z]+@example\.com`), regexp.MustCompile(`\d{4}-\d{4}-\d{4}-\d{4}`)))
+	require.Nil(t, err)
+
+	ev, ok := w.parseLogEvent([]byte(`{"level":"error","message":"charge of 4242-4242-4242-4242 failed","contact":"john@example.com","count":42,"http":{"email":"jane@example.com"}}`))
+	require.True(t, ok)
+	assert.Equal(t, "charge of [REDACTED] failed", ev.Message)
+	assert.Equal(t, Redacted, ev.Extra["contact"])
+	assert.Equal(t, int64(42), ev.Extra["count"])
+	assert.Equal(t, Redacted, ev.Contexts["http"]["email"])
+}
+
+func TestWrite_StrictParsing(t *testing.T) {
+	writer, err := New("")
+	require.Nil(t, err)
+
+	n, err := writer.Write([]byte(`{"level":"unknown"}`))
+	assert.Nil(t, err)
+	assert.Equal(t, 19, n)
+
+	_, err = writer.WriteLevel(zerolog.ErrorLevel, []byte(`{"level":"error","message":`))
+	assert.Nil(t, err)
+
+	writer, err = New("", WithStrictParsing())
+	require.Nil(t, err)
+
+	n, err = writer.Write([]byte(`{"level":"unknown"}`))
+	assert.NotNil(t, err)
+	assert.Equal(t, 19, n)
+
+	_, err = writer.WriteLevel(zerolog.ErrorLevel, []byte(`{"level":"error","message":`))
+	assert.ErrorIs(t, err, ErrMalformedLogEvent)
+
+	for _, line := range []string{`not json`, `[1,2]`, `{"message":"x"`} {
+		_, err = writer.Write([]byte(line))
+		assert.ErrorIs(t, err, ErrMalformedLogEvent, line)
+	}
+
+	// a valid line without level is not malformed
+	_, err = writer.Write([]byte(`{"message":"x"}`))
+	assert.Nil(t, err)
+
+	_, err = writer.Write(logEventJSON)
+	assert.Nil(t, err)
+}
+
+func TestWrite_MalformedDebugWriter(t *testing.T) {
+	var debug strings.Builder
+	writer, err := New("", WithDebugWriter(&debug))
+	require.Nil(t, err)
+
+	_, err = writer.WriteLevel(zerolog.ErrorLevel, []byte(`{"level":"error","message":`+"\n"))
+	assert.Nil(t, err)
+	assert.True(t, strings.HasPrefix(debug.String(), "zlogsentry: dropped malformed log line: "), debug.String())
+	assert.True(t, strings.HasSuffix(debug.String(), `: {"level":"error","message":`+"\n"), debug.String())
+
+	debug.Reset()
+	_, err = writer.WriteLevel(zerolog.ErrorLevel, []byte(`{"level":"error","message":"`+strings.Repeat("x", 300)))
+	assert.Nil(t, err)
+	assert.True(t, strings.HasSuffix(debug.String(), strings.Repeat("x", 256-len(`{"level":"error","message":"`))+"…\n"), debug.String())
+
+	// lines without a level and lines of disabled levels
+	for _, line := range []string{`not json`, `{"message":"x"`} {
+		debug.Reset()
+		_, err = writer.Write([]byte(line))
+		assert.Nil(t, err)
+		assert.True(t, strings.HasSuffix(debug.String(), ": "+line+"\n"), debug.String())
+	}
+
+	debug.Reset()
+	_, err = writer.WriteLevel(zerolog.DebugLevel, []byte(`{"level":"debug"`))
+	assert.Nil(t, err)
+	assert.True(t, strings.HasSuffix(debug.String(), `: {"level":"debug"`+"\n"), debug.String())
+
+	debug.Reset()
+	_, err = writer.Write([]byte(`{"message":"x"}`))
+	assert.Nil(t, err)
+	assert.Empty(t, debug.String())
+}
+
+func TestWrite_Platform(t *testing.T) {
+	transport := &testTransport{}
+	writer, err := New("", WithTransport(transport), WithPlatform("python"))
+	require.Nil(t, err)
+
+	_, err = writer.Write(logEventJSON)
+	require.Nil(t, err)
+	writer.WriteError(errors.New("dial timeout"), zerolog.ErrorLevel)
+
+	require.Len(t, transport.events, 2)
+	assert.Equal(t, "python", transport.events[0].Platform)
+	assert.Equal(t, "python", transport.events[1].Platform)
+}
+
 func TestWriteLevel_Disabled(t *testing.T) {
 	beforeSendCalled := false
 	writer, err := New("",
@@ -159,6 +2043,141 @@ func TestWriteLevel_Disabled(t *testing.T) {
 	require.False(t, beforeSendCalled)
 }
 
+type stackError struct {
+	msg string
+	pcs []uintptr
+}
+
+func newStackError(msg string) error {
+	pcs := make([]uintptr, 32)
+	n := runtime.Callers(2, pcs)
+	return &stackError{msg: msg, pcs: pcs[:n]}
+}
+
+func (e *stackError) Error() string         { return e.msg }
+func (e *stackError) StackTrace() []uintptr { return e.pcs }
+
+func TestWriteError(t *testing.T) {
+	errOrigin := newStackError("dial timeout")
+
+	beforeSendCalled := false
+	writer, err := New("", WithBeforeSend(func(event *sentry.Event, hint *sentry.EventHint) *sentry.Event {
+		assert.Equal(t, sentry.LevelError, event.Level)
+		assert.Equal(t, "dial timeout", event.Message)
+		require.Len(t, event.Exception, 1)
+		assert.Equal(t, "*zlogsentry.stackError", event.Exception[0].Type)
+		assert.Equal(t, "dial timeout", event.Exception[0].Value)
+
+		frames := event.Exception[0].Stacktrace.Frames
+		require.NotEmpty(t, frames)
+		assert.Equal(t, "TestWriteError", frames[len(frames)-1].Function)
+		beforeSendCalled = true
+		return event
+	}))
+	require.Nil(t, err)
+
+	writer.WriteError(errOrigin, zerolog.ErrorLevel)
+	require.True(t, beforeSendCalled)
+
+	beforeSendCalled = false
+	writer.WriteError(errOrigin, zerolog.DebugLevel)
+	require.False(t, beforeSendCalled)
+}
+
+func newDialError() error {
+	return newStackError("dial timeout")
+}
+
+func TestWriteError_Wrapped(t *testing.T) {
+	transport := &testTransport{}
+	writer, err := New("", WithTransport(transport))
+	require.Nil(t, err)
+
+	writer.WriteError(fmt.Errorf("request failed: %w", fmt.Errorf("connect: %w", newDialError())), zerolog.ErrorLevel)
+	require.Len(t, transport.events, 1)
+	event := transport.events[0]
+	assert.Equal(t, "request failed: connect: dial timeout", event.Message)
+	require.Len(t, event.Exception, 1)
+	frames := event.Exception[0].Stacktrace.Frames
+	require.NotEmpty(t, frames)
+	assert.Equal(t, "newDialError", frames[len(frames)-1].Function)
+
+	writer, err = New("", WithTransport(transport), WithMaxErrorDepth(1))
+	require.Nil(t, err)
+
+	writer.WriteError(fmt.Errorf("connect: %w", newDialError()), zerolog.ErrorLevel)
+	require.Len(t, transport.events, 2)
+	frames = transport.events[1].Exception[0].Stacktrace.Frames
+	require.NotEmpty(t, frames)
+	assert.Equal(t, "TestWriteError_Wrapped", frames[len(frames)-1].Function)
+
+	writer, err = New("", WithTransport(transport))
+	require.Nil(t, err)
+
+	for _, joined := range []error{
+		errors.Join(errors.New("cache miss"), fmt.Errorf("connect: %w", newDialError())),
+		fmt.Errorf("%w: %w", errors.New("request failed"), newDialError()),
+	} {
+		writer.WriteError(joined, zerolog.ErrorLevel)
+		event := transport.events[len(transport.events)-1]
+		frames = event.Exception[0].Stacktrace.Frames
+		require.NotEmpty(t, frames)
+		assert.Equal(t, "newDialError", frames[len(frames)-1].Function, event.Message)
+	}
+}
+
+func TestCaptureError(t *testing.T) {
+	errChain := fmt.Errorf("request failed: %w", fmt.Errorf("connect: %w", newStackError("dial timeout")))
+
+	transport := &testTransport{}
+	writer, err := New("", WithTransport(transport))
+	require.Nil(t, err)
+
+	writer.CaptureError(errChain, zerolog.ErrorLevel)
+	require.Len(t, transport.events, 1)
+	event := transport.events[0]
+	assert.Equal(t, "request failed: connect: dial timeout", event.Message)
+	require.Len(t, event.Exception, 3)
+	assert.Equal(t, "*zlogsentry.stackError", event.Exception[0].Type)
+	assert.Equal(t, "dial timeout", event.Exception[0].Value)
+	assert.NotNil(t, event.Exception[0].Stacktrace)
+	assert.Equal(t, "*fmt.wrapError", event.Exception[1].Type)
+	assert.Equal(t, "connect: dial timeout", event.Exception[1].Value)
+	assert.Nil(t, event.Exception[1].Stacktrace)
+	assert.Equal(t, "*fmt.wrapError", event.Exception[2].Type)
+	assert.Equal(t, "request failed: connect: dial timeout", event.Exception[2].Value)
+	assert.NotNil(t, event.Exception[2].Stacktrace)
+
+	writer, err = New("", WithTransport(transport), WithMaxErrorDepth(2))
+	require.Nil(t, err)
+
+	writer.CaptureError(errChain, zerolog.ErrorLevel)
+	require.Len(t, transport.events, 2)
+	event = transport.events[1]
+	require.Len(t, event.Exception, 2)
+	assert.Equal(t, "connect: dial timeout", event.Exception[0].Value)
+	assert.Equal(t, "request failed: connect: dial timeout", event.Exception[1].Value)
+}
+
+func TestTrimFrames(t *testing.T) {
+	frames := []sentry.Frame{
+		{Module: "main"},
+		{Module: "example.com/app/handler"},
+		{Module: "example.com/app/internal/log"},
+		{Module: "example.com/app/internal/log"},
+		{Module: "github.com/rs/zerolog"},
+		{Module: "github.com/rs/zerolog"},
+		{Module: module},
+		{Module: module},
+	}
+
+	trimmed := trimFrames(append([]sentry.Frame(nil), frames...), nil)
+	assert.Equal(t, frames[:4], trimmed)
+
+	trimmed = trimFrames(append([]sentry.Frame(nil), frames...), []string{"example.com/app/internal"})
+	assert.Equal(t, frames[:2], trimmed)
+}
+
 func BenchmarkParseLogEvent(b *testing.B) {
 	w, err := New("")
 	if err != nil {
@@ -170,6 +2189,61 @@ func BenchmarkParseLogEvent(b *testing.B) {
 	}
 }
 
+var multiFieldLogEventJSON = []byte(`{"level":"error","service":"billing","component":"payments","requestId":"bee07485-2485-4f64-99e1-d10165884ca7","user_id":"42","method":"POST","path":"/v1/charges","status":502,"duration":1.5,"attempt":3,"error":"dial timeout","time":"2020-06-25T17:19:00+03:00","message":"test message"}`)
+
+func BenchmarkParseLogEvent_MultiField(b *testing.B) {
+	w, err := New("", WithTags("service", "component"))
+	if err != nil {
+		b.Errorf("failed to create writer: %v", err)
+	}
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		w.parseLogEvent(multiFieldLogEventJSON)
+	}
+}
+
+var errorFieldsLogEventJSON = []byte(`{"level":"error","route":"/v1/charges","error_code":"E502","cause":"dial timeout","inner_error":"connection reset","error":"request failed","message":"test message"}`)
+
+func BenchmarkParseLogEvent_ErrorFields(b *testing.B) {
+	w, err := New("", WithErrorFieldNames("cause", "inner_error"), WithFingerprintFields("route", "error_code"))
+	if err != nil {
+		b.Errorf("failed to create writer: %v", err)
+	}
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		w.parseLogEvent(errorFieldsLogEventJSON)
+	}
+}
+
+func recurse(depth int, fn func()) {
+	if depth == 0 {
+		fn()
+		return
+	}
+	recurse(depth-1, fn)
+}
+
+func BenchmarkNewStacktrace_Deep(b *testing.B) {
+	for _, depth := range []int{0, 10} {
+		w, err := New("", WithMaxStacktraceDepth(depth))
+		if err != nil {
+			b.Errorf("failed to create writer: %v", err)
+		}
+
+		b.Run(fmt.Sprintf("max_depth_%d", depth), func(b *testing.B) {
+			recurse(200, func() {
+				b.ReportAllocs()
+				b.ResetTimer()
+				for i := 0; i < b.N; i++ {
+					w.newStacktrace()
+				}
+			})
+		})
+	}
+}
+
 func BenchmarkParseLogEvent_Disabled(b *testing.B) {
 	w, err := New("", WithLevels(zerolog.FatalLevel))
 	if err != nil {
@@ -181,6 +2255,17 @@ func BenchmarkParseLogEvent_Disabled(b *testing.B) {
 	}
 }
 
+func BenchmarkParseLogEvent_RedactPatterns(b *testing.B) {
+	w, err := New("", WithRedactPatterns(regexp.MustCompile(`[a-z]+@example\.com`)))
+	if err != nil {
+		b.Errorf("failed to create writer: %v", err)
+	}
+
+	for i := 0; i < b.N; i++ {
+		w.parseLogEvent(logEventJSON)
+	}
+}
+
 func BenchmarkWriteLogEvent(b *testing.B) {
 	w, err := New("")
 	if err != nil {